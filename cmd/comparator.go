@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	spandbcompare "github.com/castaneai/spandbcompare/pkg"
+	"github.com/urfave/cli"
+)
+
+// columnOption is a value given to the columns matching the pattern, specified as PATTERN=VALUE
+type columnOption struct {
+	filter *spandbcompare.ColumnFilter
+	value  interface{}
+}
+
+func parseColumnOptions(specs []string, parseValue func(s string) (interface{}, error)) ([]*columnOption, error) {
+	var opts []*columnOption
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid column option %q (format: PATTERN=VALUE)", spec)
+		}
+		filter, err := spandbcompare.NewColumnFilter([]string{spec[:i]})
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseValue(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid column option %q: %v", spec, err)
+		}
+		opts = append(opts, &columnOption{filter: filter, value: value})
+	}
+	return opts, nil
+}
+
+// parseFloatTolerance parses ABS[:REL]
+func parseFloatTolerance(s string) (interface{}, error) {
+	parts := strings.SplitN(s, ":", 2)
+	abs, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, err
+	}
+	ft := spandbcompare.FloatTolerance{Absolute: abs}
+	if len(parts) > 1 {
+		rel, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		ft.Relative = rel
+	}
+	return ft, nil
+}
+
+func parseDuration(s string) (interface{}, error) {
+	return time.ParseDuration(s)
+}
+
+// parseTruncation parses a unit (second, minute, hour or day) or a duration
+func parseTruncation(s string) (interface{}, error) {
+	switch s {
+	case "second":
+		return time.Second, nil
+	case "minute":
+		return time.Minute, nil
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// comparatorConfig holds the flags to build DefaultRowComparator for each table
+type comparatorConfig struct {
+	ignore                     *spandbcompare.ColumnFilter
+	floatTolerance             spandbcompare.FloatTolerance
+	columnFloatTolerances      []*columnOption
+	nan                        spandbcompare.NaNPolicy
+	signedZero                 spandbcompare.SignedZeroPolicy
+	timestampTolerance         time.Duration
+	timestampTruncation        time.Duration
+	columnTimestampTolerances  []*columnOption
+	columnTimestampTruncations []*columnOption
+	// commit timestamp columns of each table, ignored if --ignore-commit-timestamp-columns is set
+	commitTimestampColumns map[string][]string
+}
+
+func newComparatorConfig(c *cli.Context) (*comparatorConfig, error) {
+	ignore, err := spandbcompare.NewColumnFilter(listFlag(c, "ignore-columns"))
+	if err != nil {
+		return nil, err
+	}
+	cfts, err := parseColumnOptions(listFlag(c, "column-float-tolerance"), parseFloatTolerance)
+	if err != nil {
+		return nil, err
+	}
+	ctts, err := parseColumnOptions(listFlag(c, "column-timestamp-tolerance"), parseDuration)
+	if err != nil {
+		return nil, err
+	}
+	ctrs, err := parseColumnOptions(listFlag(c, "column-timestamp-truncate"), parseTruncation)
+	if err != nil {
+		return nil, err
+	}
+	cc := &comparatorConfig{
+		ignore: ignore,
+		floatTolerance: spandbcompare.FloatTolerance{
+			Absolute: c.GlobalFloat64("float-abs-tolerance"),
+			Relative: c.GlobalFloat64("float-rel-tolerance"),
+		},
+		columnFloatTolerances:      cfts,
+		timestampTolerance:         c.GlobalDuration("timestamp-tolerance"),
+		columnTimestampTolerances:  ctts,
+		columnTimestampTruncations: ctrs,
+		commitTimestampColumns:     make(map[string][]string),
+	}
+	if s := c.GlobalString("timestamp-truncate"); s != "" {
+		tr, err := parseTruncation(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp-truncate: %v", err)
+		}
+		cc.timestampTruncation = tr.(time.Duration)
+	}
+
+	switch c.GlobalString("nan-policy") {
+	case "equal":
+		cc.nan = spandbcompare.NaNEqual
+	case "not-equal":
+		cc.nan = spandbcompare.NaNNotEqual
+	default:
+		return nil, fmt.Errorf("nan-policy must be 'equal' or 'not-equal'")
+	}
+	switch c.GlobalString("signed-zero-policy") {
+	case "equal":
+		cc.signedZero = spandbcompare.SignedZeroEqual
+	case "distinct":
+		cc.signedZero = spandbcompare.SignedZeroDistinct
+	default:
+		return nil, fmt.Errorf("signed-zero-policy must be 'equal' or 'distinct'")
+	}
+	return cc, nil
+}
+
+func (cc *comparatorConfig) comparator(table string, cols []string) *spandbcompare.DefaultRowComparator {
+	cmp := &spandbcompare.DefaultRowComparator{
+		IgnoreColumns:              cc.ignore.Filter(table, cols),
+		FloatTolerance:             cc.floatTolerance,
+		ColumnFloatTolerances:      make(map[string]spandbcompare.FloatTolerance),
+		NaN:                        cc.nan,
+		SignedZero:                 cc.signedZero,
+		TimestampTolerance:         cc.timestampTolerance,
+		TimestampTruncation:        cc.timestampTruncation,
+		ColumnTimestampTolerances:  make(map[string]time.Duration),
+		ColumnTimestampTruncations: make(map[string]time.Duration),
+	}
+	cmp.IgnoreColumns = append(cmp.IgnoreColumns, cc.commitTimestampColumns[table]...)
+	for _, opt := range cc.columnFloatTolerances {
+		for _, cn := range opt.filter.Filter(table, cols) {
+			cmp.ColumnFloatTolerances[cn] = opt.value.(spandbcompare.FloatTolerance)
+		}
+	}
+	for _, opt := range cc.columnTimestampTolerances {
+		for _, cn := range opt.filter.Filter(table, cols) {
+			cmp.ColumnTimestampTolerances[cn] = opt.value.(time.Duration)
+		}
+	}
+	for _, opt := range cc.columnTimestampTruncations {
+		for _, cn := range opt.filter.Filter(table, cols) {
+			cmp.ColumnTimestampTruncations[cn] = opt.value.(time.Duration)
+		}
+	}
+	return cmp
+}
+
+// ignoreCommitTimestampColumns ignores the columns with allow_commit_timestamp=true in either schema
+func (cc *comparatorConfig) ignoreCommitTimestampColumns(schemas ...*spandbcompare.Schema) {
+	for _, s := range schemas {
+		for _, t := range s.Tables {
+			cc.commitTimestampColumns[t.Name] = append(cc.commitTimestampColumns[t.Name], t.CommitTimestampColumns()...)
+		}
+	}
+}
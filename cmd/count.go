@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	spandbcompare "github.com/castaneai/spandbcompare/pkg"
+	"github.com/urfave/cli"
+)
+
+// compareCounts writes the row counts of each table on both servers and their delta.
+// The tables existing on only one server are written as mismatches.
+// The count differences are recorded in stats as missing rows.
+func compareCounts(ctx context.Context, c *cli.Context, dbs *databases, td *spandbcompare.TablesDiff, stats *diffStats) error {
+	tables, exists1, exists2 := allTables(td)
+
+	report, err := spandbcompare.NewCountReport(c.App.Writer, string(dbs.dsn1), string(dbs.dsn2))
+	if err != nil {
+		return err
+	}
+	if err := report.WriteHeader(); err != nil {
+		return err
+	}
+	return spandbcompare.CompareTables(ctx, tables, c.GlobalInt("parallelism"), c.App.Writer, func(ctx context.Context, table string, w io.Writer) error {
+		var ds1, ds2 *spandbcompare.DataSource
+		var err error
+		if exists1[table] {
+			if ds1, err = spandbcompare.NewDataSource(ctx, dbs.c1, table, dbs.dsopts1...); err != nil {
+				return err
+			}
+		}
+		if exists2[table] {
+			if ds2, err = spandbcompare.NewDataSource(ctx, dbs.c2, table, dbs.dsopts2...); err != nil {
+				return err
+			}
+		}
+		tc, err := spandbcompare.CountRows(ctx, table, ds1, ds2)
+		if err != nil {
+			return err
+		}
+		n := tc.Delta()
+		if n < 0 {
+			n = -n
+		}
+		// a table on only one server is a difference even if it has no rows
+		if n == 0 && !(tc.Exists1 && tc.Exists2) {
+			n = 1
+		}
+		stats.addMissing(int(n))
+		r, err := spandbcompare.NewCountReport(w, string(dbs.dsn1), string(dbs.dsn2))
+		if err != nil {
+			return err
+		}
+		return r.Write(tc)
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	spandbcompare "github.com/castaneai/spandbcompare/pkg"
+	"github.com/castaneai/spankeys"
+	"github.com/urfave/cli"
+)
+
+// databases are the two databases to compare and the options to read and compare their tables
+type databases struct {
+	dsn1, dsn2       spankeys.DSN
+	c1, c2           *spanner.Client
+	tb1, tb2         spanner.TimestampBound
+	readAt1, readAt2 string
+	dsopts1, dsopts2 []spandbcompare.DataSourceOption
+	filter           *spandbcompare.TableFilter
+	cc               *comparatorConfig
+	closers          []func()
+}
+
+func openDatabases(ctx context.Context, c *cli.Context) (*databases, error) {
+	tb1, tb2, err := timestampBounds(c)
+	if err != nil {
+		return nil, err
+	}
+	dsn1, err := spankeys.NewDSN(c.GlobalString("server1"))
+	if err != nil {
+		return nil, err
+	}
+	dsn2, err := spankeys.NewDSN(c.GlobalString("server2"))
+	if err != nil {
+		return nil, err
+	}
+	filter, err := spandbcompare.NewTableFilter(listFlag(c, "include-tables"), listFlag(c, "exclude-tables"))
+	if err != nil {
+		return nil, err
+	}
+	cc, err := newComparatorConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	dbs := &databases{
+		dsn1:   dsn1,
+		dsn2:   dsn2,
+		filter: filter,
+		cc:     cc,
+	}
+	dbs.setTimestampBounds(tb1, tb2)
+	if dbs.c1, err = spanner.NewClient(ctx, string(dsn1)); err != nil {
+		return nil, err
+	}
+	dbs.closers = append(dbs.closers, dbs.c1.Close)
+	if c.GlobalBool("same-timestamp") {
+		ts, err := sameReadTimestamp(ctx, dbs.c1, c.GlobalDuration("exact-staleness"))
+		if err != nil {
+			dbs.Close()
+			return nil, err
+		}
+		dbs.setTimestampBounds(spanner.ReadTimestamp(ts), spanner.ReadTimestamp(ts))
+	}
+	if dbs.c2, err = spanner.NewClient(ctx, string(dsn2)); err != nil {
+		dbs.Close()
+		return nil, err
+	}
+	dbs.closers = append(dbs.closers, dbs.c2.Close)
+	return dbs, nil
+}
+
+func (dbs *databases) setTimestampBounds(tb1, tb2 spanner.TimestampBound) {
+	dbs.tb1, dbs.tb2 = tb1, tb2
+	dbs.readAt1, dbs.readAt2 = describeTimestampBound(tb1), describeTimestampBound(tb2)
+	dbs.dsopts1 = []spandbcompare.DataSourceOption{spandbcompare.WithTimestampBound(tb1)}
+	dbs.dsopts2 = []spandbcompare.DataSourceOption{spandbcompare.WithTimestampBound(tb2)}
+}
+
+func (dbs *databases) Close() {
+	for i := len(dbs.closers) - 1; i >= 0; i-- {
+		dbs.closers[i]()
+	}
+}
+
+// prepare loads the options which need to read the databases, and begins snapshots if --snapshot is set
+func (dbs *databases) prepare(ctx context.Context, c *cli.Context) error {
+	if c.GlobalBool("ignore-commit-timestamp-columns") {
+		s1, err := spandbcompare.LoadSchema(ctx, dbs.c1)
+		if err != nil {
+			return err
+		}
+		s2, err := spandbcompare.LoadSchema(ctx, dbs.c2)
+		if err != nil {
+			return err
+		}
+		dbs.cc.ignoreCommitTimestampColumns(s1, s2)
+	}
+
+	if c.GlobalBool("snapshot") {
+		if c.GlobalDuration("max-staleness") > 0 {
+			return fmt.Errorf("max-staleness cannot be used with snapshot")
+		}
+		tx1, ts1, err := beginSnapshot(ctx, dbs.c1, dbs.tb1)
+		if err != nil {
+			return err
+		}
+		dbs.closers = append(dbs.closers, tx1.Close)
+		tx2, ts2, err := beginSnapshot(ctx, dbs.c2, dbs.tb2)
+		if err != nil {
+			return err
+		}
+		dbs.closers = append(dbs.closers, tx2.Close)
+		dbs.readAt1, dbs.readAt2 = ts1.Format(time.RFC3339Nano), ts2.Format(time.RFC3339Nano)
+		dbs.dsopts1 = append(dbs.dsopts1, spandbcompare.WithReadOnlyTransaction(tx1))
+		dbs.dsopts2 = append(dbs.dsopts2, spandbcompare.WithReadOnlyTransaction(tx2))
+	}
+	return nil
+}
+
+// tables compares the names of the tables matching the filter
+func (dbs *databases) tables(ctx context.Context) (*spandbcompare.TablesDiff, error) {
+	tables1, err := spankeys.GetTables(ctx, dbs.c1)
+	if err != nil {
+		return nil, err
+	}
+	tables2, err := spankeys.GetTables(ctx, dbs.c2)
+	if err != nil {
+		return nil, err
+	}
+	return spandbcompare.CompareTableNames(dbs.filter.Filter(tableNames(tables1)), dbs.filter.Filter(tableNames(tables2))), nil
+}
+
+// keyColumns returns the largest number of the primary key columns of the tables on either database
+func (dbs *databases) keyColumns(ctx context.Context, tables []string) (int, error) {
+	compared := make(map[string]bool)
+	for _, table := range tables {
+		compared[table] = true
+	}
+	n := 1
+	for _, client := range []*spanner.Client{dbs.c1, dbs.c2} {
+		s, err := spandbcompare.LoadSchema(ctx, client)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range s.Tables {
+			if compared[t.Name] && len(t.PrimaryKey) > n {
+				n = len(t.PrimaryKey)
+			}
+		}
+	}
+	return n, nil
+}
+
+// allTables returns the tables existing on either database ordered by name, and whether each of them exists on each database
+func allTables(td *spandbcompare.TablesDiff) ([]string, map[string]bool, map[string]bool) {
+	exists1, exists2 := make(map[string]bool), make(map[string]bool)
+	var tables []string
+	for _, table := range td.CommonTables {
+		exists1[table], exists2[table] = true, true
+		tables = append(tables, table)
+	}
+	for _, table := range td.Tables1Only {
+		exists1[table] = true
+		tables = append(tables, table)
+	}
+	for _, table := range td.Tables2Only {
+		exists2[table] = true
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables, exists1, exists2
+}
+
+// logSkippedTables logs the tables existing only on either database, whose rows are not compared
+func (dbs *databases) logSkippedTables(td *spandbcompare.TablesDiff) {
+	for _, table := range td.Tables1Only {
+		log.Printf("table %s exists only on %s, skipped", table, dbs.dsn1)
+	}
+	for _, table := range td.Tables2Only {
+		log.Printf("table %s exists only on %s, skipped", table, dbs.dsn2)
+	}
+}
+
+// compareRows compares the rows of the table according to --mode (full or checksum) and returns the columns and the differences
+func (dbs *databases) compareRows(ctx context.Context, c *cli.Context, table string) ([]string, *spandbcompare.RowsDiff, error) {
+	rd := &spandbcompare.RowsDiff{}
+	cns, err := dbs.streamRows(ctx, c, table, rd)
+	if err != nil {
+		return nil, nil, err
+	}
+	rd.Columns = cns
+	return cns, rd, nil
+}
+
+// streamRows compares the rows of the table like compareRows but passes the differences to h as they are found, and returns the columns.
+// The tables whose columns differ between the servers are compared in full even in checksum mode.
+func (dbs *databases) streamRows(ctx context.Context, c *cli.Context, table string, h spandbcompare.RowsDiffHandler) ([]string, error) {
+	ds1, err := spandbcompare.NewDataSource(ctx, dbs.c1, table, dbs.dsopts1...)
+	if err != nil {
+		return nil, err
+	}
+	ds2, err := spandbcompare.NewDataSource(ctx, dbs.c2, table, dbs.dsopts2...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows of both servers are merged in the key order of server1
+	if !reflect.DeepEqual(ds1.KeyOrder(), ds2.KeyOrder()) {
+		return nil, fmt.Errorf("the primary key order (ASC/DESC) of table %s differs between the servers", table)
+	}
+
+	cols, err := spankeys.GetColumns(ctx, dbs.c1, table)
+	if err != nil {
+		return nil, err
+	}
+	var cns []string
+	for _, col := range cols {
+		cns = append(cns, col.Name)
+	}
+
+	cmp := dbs.cc.comparator(table, cns)
+	mode := c.GlobalString("mode")
+	var checksumCols []string
+	if mode == "checksum" {
+		cols2, err := spankeys.GetColumns(ctx, dbs.c2, table)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if checksumCols, ok = checksumColumns(cns, cols2, cmp.IgnoreColumns); !ok {
+			// the checksums cannot include the columns existing on only one server
+			log.Printf("columns of table %s differ between the servers, compared in full", table)
+			mode = "full"
+		}
+	}
+
+	if mode == "checksum" {
+		if err := spandbcompare.CompareByChecksum(ctx, ds1, ds2, cmp, checksumCols, c.GlobalInt("checksum-buckets"), h); err != nil {
+			return nil, err
+		}
+	} else if n := c.GlobalInt("partitions"); n > 1 {
+		ranges, err := ds1.SplitKeyRanges(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		if err := spandbcompare.ComparePartitioned(ctx, ds1, ds2, cmp, ranges, c.GlobalInt("partition-parallelism"), h); err != nil {
+			return nil, err
+		}
+	} else if err := spandbcompare.CompareRowIteratorsInOrder(ds1.RowIterator(ctx), ds2.RowIterator(ctx), ds1.KeyOrder(), cmp, h); err != nil {
+		return nil, err
+	}
+	return cns, nil
+}
+
+// validatePartitions checks that --partitions is used in full mode, since checksum mode reads only the rows of differing buckets
+func validatePartitions(c *cli.Context, mode string) error {
+	if c.GlobalInt("partitions") > 1 && mode == "checksum" {
+		return fmt.Errorf("partitions cannot be used with checksum mode")
+	}
+	if c.GlobalInt("partition-parallelism") < 1 {
+		return fmt.Errorf("partition-parallelism must be positive")
+	}
+	return nil
+}
+
+// checksumColumns returns the columns except the ignored columns.
+// ok is false if any of them exists on only one server, since the checksums of such a table always differ.
+func checksumColumns(cns []string, cols2 []*spankeys.Column, ignoreColumns []string) ([]string, bool) {
+	ignored := make(map[string]bool)
+	for _, cn := range ignoreColumns {
+		ignored[cn] = true
+	}
+	exists1 := make(map[string]bool)
+	for _, cn := range cns {
+		exists1[cn] = true
+	}
+	for _, col := range cols2 {
+		if !exists1[col.Name] && !ignored[col.Name] {
+			return nil, false
+		}
+	}
+	exists2 := make(map[string]bool)
+	for _, col := range cols2 {
+		exists2[col.Name] = true
+	}
+	var columns []string
+	for _, cn := range cns {
+		if ignored[cn] {
+			continue
+		}
+		if !exists2[cn] {
+			return nil, false
+		}
+		columns = append(columns, cn)
+	}
+	return columns, true
+}
+
+// changesFor returns the label of --changes-for out of the labels of server1 and server2
+func changesFor(c *cli.Context, label1, label2 string) (string, error) {
+	cfs := c.GlobalString("changes-for")
+	if cfs != "server1" && cfs != "server2" {
+		return "", fmt.Errorf("changesFor must be 'server1' or 'server2'")
+	}
+	if cfs == "server2" {
+		return label2, nil
+	}
+	return label1, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	spandbcompare "github.com/castaneai/spandbcompare/pkg"
+	"github.com/urfave/cli"
+)
+
+const (
+	exitCodeDiff  = 1
+	exitCodeError = 2
+)
+
+var failOnKinds = []string{"schema", "missing", "changed"}
+
+// diffStats counts the differences of each kind. It is safe for concurrent use by table tasks.
+type diffStats struct {
+	schema  int64
+	missing int64
+	changed int64
+}
+
+func (s *diffStats) addSchema(n int) {
+	atomic.AddInt64(&s.schema, int64(n))
+}
+
+func (s *diffStats) addMissing(n int) {
+	atomic.AddInt64(&s.missing, int64(n))
+}
+
+func (s *diffStats) addRowsDiff(rd *spandbcompare.RowsDiff) {
+	atomic.AddInt64(&s.missing, int64(len(rd.Rows1Only)+len(rd.Rows2Only)))
+	atomic.AddInt64(&s.changed, int64(len(rd.DiffRows)))
+}
+
+// OnRows1Only, OnRows2Only and OnDiffRow make diffStats a RowsDiffHandler counting the differences passed
+func (s *diffStats) OnRows1Only(row *spandbcompare.Row) error {
+	s.addMissing(1)
+	return nil
+}
+
+func (s *diffStats) OnRows2Only(row *spandbcompare.Row) error {
+	s.addMissing(1)
+	return nil
+}
+
+func (s *diffStats) OnDiffRow(rd *spandbcompare.RowDiff) error {
+	atomic.AddInt64(&s.changed, 1)
+	return nil
+}
+
+func (s *diffStats) count(kind string) int64 {
+	switch kind {
+	case "schema":
+		return atomic.LoadInt64(&s.schema)
+	case "missing":
+		return atomic.LoadInt64(&s.missing)
+	case "changed":
+		return atomic.LoadInt64(&s.changed)
+	}
+	return 0
+}
+
+// parseFailOn validates the kinds of differences given by --fail-on
+func parseFailOn(kinds []string) ([]string, error) {
+	if len(kinds) < 1 {
+		return failOnKinds, nil
+	}
+	for _, kind := range kinds {
+		valid := false
+		for _, k := range failOnKinds {
+			if kind == k {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("fail-on must be 'schema', 'missing' or 'changed'")
+		}
+	}
+	return kinds, nil
+}
+
+// exitError returns an error with exitCodeDiff if differences of the kinds in failOn are found
+func (s *diffStats) exitError(failOn []string) error {
+	var found []string
+	for _, kind := range failOn {
+		if n := s.count(kind); n > 0 {
+			found = append(found, fmt.Sprintf("%d %s", n, kind))
+		}
+	}
+	if len(found) < 1 {
+		return nil
+	}
+	return cli.NewExitError(fmt.Sprintf("differences found: %s", strings.Join(found, ", ")), exitCodeDiff)
+}
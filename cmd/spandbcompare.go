@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/castaneai/spankeys"
 
@@ -32,6 +34,7 @@ func main() {
 	app.Name = Name
 	app.Version = Version
 	app.Usage = "Compare two Cloud Spanner tables"
+	app.Description = "Exits with 0 if no differences are found, 1 if differences are found and 2 on errors"
 	app.UsageText = fmt.Sprintf("%s [options]", app.Name)
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -51,115 +54,330 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:  "difftype",
-			Usage: `How to display diff-style output, "unified" or "sql"`,
+			Usage: `How to display diff-style output, "unified", "sql", "sql-params" (JSON Lines of DML with typed query parameters), "json" (a document per table), "jsonl" (JSON Lines, a line per row), "csv" or "tsv" (a record per differing column) or "mutations" (JSON Lines of Spanner mutations to apply)`,
 			Value: "unified",
 		},
+		cli.StringSliceFlag{
+			Name:  "include-tables",
+			Usage: "Compare only the tables matching the names, glob patterns (e.g. User*) or regular expressions enclosed in slashes (e.g. /^User/)",
+		},
+		cli.StringSliceFlag{
+			Name:  "exclude-tables",
+			Usage: "Skip the tables matching the names, glob patterns or regular expressions enclosed in slashes",
+		},
+		cli.StringSliceFlag{
+			Name:  "ignore-columns",
+			Usage: "Ignore differences of the columns matching Column or Table.Column, each part accepts glob patterns or regular expressions enclosed in slashes (e.g. *.UpdatedAt)",
+		},
+		cli.Float64Flag{
+			Name:  "float-abs-tolerance",
+			Usage: "Treat FLOAT64 values as equal if the absolute difference is within the tolerance",
+		},
+		cli.Float64Flag{
+			Name:  "float-rel-tolerance",
+			Usage: "Treat FLOAT64 values as equal if the difference relative to the larger absolute value is within the tolerance",
+		},
+		cli.StringSliceFlag{
+			Name:  "column-float-tolerance",
+			Usage: "FLOAT64 tolerance for the columns matching the pattern, overriding the global tolerances (format: PATTERN=ABS[:REL], e.g. *.Price=0.001)",
+		},
+		cli.StringFlag{
+			Name:  "nan-policy",
+			Usage: `Whether NaN equals NaN, "equal" or "not-equal"`,
+			Value: "equal",
+		},
+		cli.StringFlag{
+			Name:  "signed-zero-policy",
+			Usage: `Whether +0 equals -0, "equal" or "distinct"`,
+			Value: "equal",
+		},
+		cli.DurationFlag{
+			Name:  "timestamp-tolerance",
+			Usage: "Treat TIMESTAMP values as equal if the difference is within the tolerance (e.g. 5s)",
+		},
+		cli.StringFlag{
+			Name:  "timestamp-truncate",
+			Usage: `Truncate TIMESTAMP values before comparison, "second", "minute", "hour", "day" or a duration (e.g. 10ms)`,
+		},
+		cli.StringSliceFlag{
+			Name:  "column-timestamp-tolerance",
+			Usage: "TIMESTAMP tolerance for the columns matching the pattern (format: PATTERN=DURATION, e.g. *.UpdatedAt=5s)",
+		},
+		cli.StringSliceFlag{
+			Name:  "column-timestamp-truncate",
+			Usage: "TIMESTAMP truncation for the columns matching the pattern (format: PATTERN=UNIT, e.g. Singers.Birthday=day)",
+		},
+		cli.BoolFlag{
+			Name:  "ignore-commit-timestamp-columns",
+			Usage: "Ignore the columns with allow_commit_timestamp=true",
+		},
+		cli.StringFlag{
+			Name:  "read-timestamp",
+			Usage: "Read both servers at the timestamp (format: RFC3339, e.g. 2020-01-29T12:00:00Z)",
+		},
+		cli.StringFlag{
+			Name:  "read-timestamp1",
+			Usage: "Read the first server at the timestamp, overriding --read-timestamp",
+		},
+		cli.StringFlag{
+			Name:  "read-timestamp2",
+			Usage: "Read the second server at the timestamp, overriding --read-timestamp",
+		},
+		cli.DurationFlag{
+			Name:  "exact-staleness",
+			Usage: "Read both servers at the timestamp exactly the duration ago (e.g. 15s)",
+		},
+		cli.DurationFlag{
+			Name:  "max-staleness",
+			Usage: "Read both servers at a timestamp at most the duration ago",
+		},
+		cli.BoolFlag{
+			Name:  "same-timestamp",
+			Usage: "Read both servers at the same timestamp, the current timestamp of the first server or --exact-staleness before it",
+		},
+		cli.BoolFlag{
+			Name:  "snapshot",
+			Usage: "Read all tables of each server in a single read-only transaction so that they are compared at one consistent version",
+		},
+		cli.IntFlag{
+			Name:  "parallelism",
+			Usage: "The number of tables compared at once",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "partitions",
+			Usage: "Split each table into the number of key ranges and compare them concurrently (use with --snapshot for a consistent result, cannot be used with --mode checksum)",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "partition-parallelism",
+			Usage: "The number of key ranges of a table compared at once with --partitions, so up to --parallelism times this many queries run on each server",
+			Value: 4,
+		},
+		cli.StringFlag{
+			Name:  "mode",
+			Usage: `How to compare rows, "full" downloads all rows, "checksum" compares checksums of key buckets on the servers and downloads only the rows in differing buckets, "count" compares only the row counts`,
+			Value: "full",
+		},
+		cli.IntFlag{
+			Name:  "checksum-buckets",
+			Usage: "The number of key buckets in checksum mode",
+			Value: 1024,
+		},
+		cli.StringFlag{
+			Name:  "html-report",
+			Usage: "Also write the differences of rows to the file as a self-contained HTML report",
+		},
+		cli.StringSliceFlag{
+			Name:  "fail-on",
+			Usage: `The kinds of differences which make the exit code 1, "schema", "missing" (rows) or "changed" (rows) (default: all)`,
+		},
+		cli.BoolFlag{
+			Name:  "schema",
+			Usage: `Compare the schema (tables, columns, indexes and foreign keys) before comparing data, with difftype "unified" or "sql"`,
+		},
+		cli.BoolFlag{
+			Name:  "schema-only",
+			Usage: `Compare only the schema and skip comparing data, with difftype "unified" or "sql"`,
+		},
 	}
 	app.Action = cmdMain
+	app.Commands = []cli.Command{syncCommand}
+	// errors with exit codes (differences found) exit in app.Run
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		os.Exit(exitCodeError)
 	}
 }
 
 func cmdMain(c *cli.Context) error {
 	ctx := context.Background()
-	dsn1, err := spankeys.NewDSN(c.GlobalString("server1"))
+	dbs, err := openDatabases(ctx, c)
 	if err != nil {
 		return err
 	}
-	dsn2, err := spankeys.NewDSN(c.GlobalString("server2"))
-	if err != nil {
+	defer dbs.Close()
+	dsn1, dsn2 := dbs.dsn1, dbs.dsn2
+
+	mode := c.GlobalString("mode")
+	if mode != "full" && mode != "checksum" && mode != "count" {
+		return fmt.Errorf("mode must be 'full', 'checksum' or 'count'")
+	}
+	if mode == "checksum" && c.GlobalInt("checksum-buckets") < 1 {
+		return fmt.Errorf("checksum-buckets must be positive")
+	}
+	if err := validatePartitions(c, mode); err != nil {
 		return err
 	}
 
-	c1, err := spanner.NewClient(ctx, string(dsn1))
+	failOn, err := parseFailOn(listFlag(c, "fail-on"))
 	if err != nil {
 		return err
 	}
-	defer c1.Close()
-	c2, err := spanner.NewClient(ctx, string(dsn2))
-	if err != nil {
-		return err
+	stats := &diffStats{}
+
+	schemaCompared := c.GlobalBool("schema") || c.GlobalBool("schema-only")
+	// the schema diff is text, which would break the machine-readable outputs
+	if difftype := c.GlobalString("difftype"); schemaCompared && difftype != "unified" && difftype != "sql" {
+		return fmt.Errorf("schema and schema-only can be used only with difftype 'unified' or 'sql'")
+	}
+	if schemaCompared {
+		sd, err := showSchemaDiff(ctx, c, dbs.c1, dbs.c2, dbs.filter, string(dsn1), string(dsn2))
+		if err != nil {
+			return err
+		}
+		stats.addSchema(len(sd.Tables1Only) + len(sd.Tables2Only) + len(sd.DiffTables))
+		if c.GlobalBool("schema-only") {
+			return stats.exitError(failOn)
+		}
 	}
-	defer c2.Close()
 
-	tables1, err := spankeys.GetTables(ctx, c1)
-	if err != nil {
+	if err := dbs.prepare(ctx, c); err != nil {
 		return err
 	}
-	tables2, err := spankeys.GetTables(ctx, c1)
+	td, err := dbs.tables(ctx)
 	if err != nil {
 		return err
 	}
-	if len(tables1) != len(tables2) {
-		return fmt.Errorf("the list of tables differs among %s and %s", dsn1, dsn2)
+	if !schemaCompared {
+		stats.addSchema(len(td.Tables1Only) + len(td.Tables2Only))
 	}
 
-	for _, table := range tables1 {
-		ds1, err := spandbcompare.NewDataSource(ctx, c1, table.Name)
-		if err != nil {
+	if mode == "count" {
+		// the tables existing on only one server are reported as mismatches instead of skipped
+		writeReadTimestamps(c.App.Writer, "# ", dbs)
+		if err := compareCounts(ctx, c, dbs, td, stats); err != nil {
 			return err
 		}
-		ds2, err := spandbcompare.NewDataSource(ctx, c2, table.Name)
-		if err != nil {
+		return stats.exitError(failOn)
+	}
+
+	var report *spandbcompare.HTMLReport
+	if c.GlobalString("html-report") != "" {
+		title := fmt.Sprintf("%s: %s vs %s", Name, dsn1, dsn2)
+		if report, err = spandbcompare.NewHTMLReport(title, string(dsn1), string(dsn2)); err != nil {
 			return err
 		}
+		report.SetReadTimestamps(dbs.readAt1, dbs.readAt2)
+	}
 
-		stmt := spanner.NewStatement(fmt.Sprintf("SELECT * FROM `%s`", table.Name))
-		rows1, err := ds1.Rows(ctx, stmt)
-		if err != nil {
+	switch c.GlobalString("difftype") {
+	case "unified":
+		writeReadTimestamps(c.App.Writer, "# ", dbs)
+	case "sql":
+		writeReadTimestamps(c.App.Writer, "-- ", dbs)
+	}
+
+	tables, exists1, exists2 := allTables(td)
+	// the header of csv and tsv has a field per primary key column of the table with the most of them
+	keyColumns := 1
+	if difftype := c.GlobalString("difftype"); difftype == "csv" || difftype == "tsv" {
+		if keyColumns, err = dbs.keyColumns(ctx, tables); err != nil {
 			return err
 		}
-		rows2, err := ds2.Rows(ctx, stmt)
+		cd, err := newCSVDiff(c, c.App.Writer, "", "", "", keyColumns)
 		if err != nil {
 			return err
 		}
-		cmp := &spandbcompare.DefaultRowComparator{}
-		rd, err := spandbcompare.CompareRows(rows1, rows2, cmp)
-		if err != nil {
+		if err := cd.WriteHeader(); err != nil {
 			return err
 		}
+	}
 
-		cols, err := spankeys.GetColumns(ctx, c1, table.Name)
+	if err := spandbcompare.CompareTables(ctx, tables, c.GlobalInt("parallelism"), c.App.Writer, func(ctx context.Context, table string, w io.Writer) error {
+		if !exists1[table] || !exists2[table] {
+			onlyOn := dsn1
+			if exists2[table] {
+				onlyOn = dsn2
+			}
+			return showTableOnlyOn(c, w, table, string(onlyOn), dbs, keyColumns, report)
+		}
+		if c.GlobalString("difftype") == "jsonl" {
+			return streamJSONLines(ctx, c, w, dbs, table, stats, report)
+		}
+		cns, rd, err := dbs.compareRows(ctx, c, table)
 		if err != nil {
 			return err
 		}
-		var cns []string
-		for _, col := range cols {
-			cns = append(cns, col.Name)
+		stats.addRowsDiff(rd)
+		if report != nil {
+			report.AddTable(table, cns, rd)
 		}
 
 		switch c.GlobalString("difftype") {
-		case "sql":
-			table1 := table.Name
-			table2 := table.Name
-			if err := showSQLDiff(c, cns, rd, table1, table2); err != nil {
+		case "sql", "sql-params":
+			if err := showSQLDiff(c, w, rd, table, string(dsn1), string(dsn2)); err != nil {
+				return err
+			}
+			break
+		case "json":
+			if err := showJSONDiff(c, w, rd, table, dbs); err != nil {
+				return err
+			}
+			break
+		case "mutations":
+			if err := showMutationDiff(c, w, rd, table, string(dsn1), string(dsn2)); err != nil {
+				return err
+			}
+			break
+		case "csv", "tsv":
+			if err := showCSVDiff(c, w, rd, table, string(dsn1), string(dsn2), keyColumns); err != nil {
 				return err
 			}
 			break
 		default:
-			label1 := fmt.Sprintf("%s on %s", table.Name, dsn1)
-			label2 := fmt.Sprintf("%s on %s", table.Name, dsn2)
-			if err := showUnifiedDiff(c, cns, rd, label1, label2); err != nil {
+			label1 := fmt.Sprintf("%s on %s", table, dsn1)
+			label2 := fmt.Sprintf("%s on %s", table, dsn2)
+			if err := showUnifiedDiff(c, w, cns, rd, label1, label2); err != nil {
 				return err
 			}
 			break
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
-	return nil
+	if report != nil {
+		if err := writeHTMLReport(c, report, string(dsn1), string(dsn2)); err != nil {
+			return err
+		}
+	}
+	return stats.exitError(failOn)
 }
 
-func showUnifiedDiff(c *cli.Context, cols []string, rd *spandbcompare.RowsDiff, label1, label2 string) error {
-	cfs := c.GlobalString("changes-for")
-	if cfs != "server1" && cfs != "server2" {
-		return fmt.Errorf("changesFor must be 'server1' or 'server2'")
+// listFlag returns the values of a repeatable flag, each of which may also be a comma-separated list.
+// Regular expressions enclosed in slashes are not split since they may contain commas.
+func listFlag(c *cli.Context, name string) []string {
+	var values []string
+	for _, v := range c.GlobalStringSlice(name) {
+		if len(v) >= 2 && strings.HasPrefix(v, "/") && strings.HasSuffix(v, "/") {
+			values = append(values, v)
+			continue
+		}
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
 	}
-	changesFor := label1
-	if cfs == "server2" {
-		changesFor = label2
+	return values
+}
+
+func tableNames(tables []*spankeys.Table) []string {
+	var names []string
+	for _, t := range tables {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func showUnifiedDiff(c *cli.Context, w io.Writer, cols []string, rd *spandbcompare.RowsDiff, label1, label2 string) error {
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return err
 	}
 
-	ud, err := spandbcompare.NewUnifiedDiff(c.App.Writer, cols, label1, label2)
+	ud, err := spandbcompare.NewUnifiedDiff(w, cols, label1, label2)
 	if err != nil {
 		return err
 	}
@@ -169,26 +387,219 @@ func showUnifiedDiff(c *cli.Context, cols []string, rd *spandbcompare.RowsDiff,
 	return nil
 }
 
-func showSQLDiff(c *cli.Context, cols []string, rd *spandbcompare.RowsDiff, table1, table2 string) error {
-	cfs := c.GlobalString("changes-for")
-	if cfs != "server1" && cfs != "server2" {
-		return fmt.Errorf("changesFor must be 'server1' or 'server2'")
-	}
-	changesFor := table1
-	if cfs == "server2" {
-		changesFor = table2
+func showSQLDiff(c *cli.Context, w io.Writer, rd *spandbcompare.RowsDiff, table, label1, label2 string) error {
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return err
 	}
 
-	sd, err := spandbcompare.NewSQLDiff(rd, table1, table2)
+	sd, err := spandbcompare.NewTableSQLDiff(rd, table, label1, label2)
 	if err != nil {
 		return err
 	}
+	if c.GlobalString("difftype") == "sql-params" {
+		stmts, err := sd.Statements(changesFor)
+		if err != nil {
+			return err
+		}
+		return spandbcompare.WriteStatements(w, stmts)
+	}
 	sqls, err := sd.SQL(changesFor)
 	if err != nil {
 		return err
 	}
 	for _, sql := range sqls {
-		fmt.Fprintln(c.App.Writer, sql)
+		fmt.Fprintln(w, sql)
 	}
 	return nil
 }
+
+func showMutationDiff(c *cli.Context, w io.Writer, rd *spandbcompare.RowsDiff, table, label1, label2 string) error {
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return err
+	}
+
+	md, err := spandbcompare.NewMutationDiff(rd, table, label1, label2)
+	if err != nil {
+		return err
+	}
+	ms, err := md.Mutations(changesFor)
+	if err != nil {
+		return err
+	}
+	return spandbcompare.WriteMutations(w, ms)
+}
+
+func showJSONDiff(c *cli.Context, w io.Writer, rd *spandbcompare.RowsDiff, table string, dbs *databases) error {
+	label1, label2 := string(dbs.dsn1), string(dbs.dsn2)
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return err
+	}
+
+	jd, err := spandbcompare.NewJSONDiff(w, table, label1, label2)
+	if err != nil {
+		return err
+	}
+	jd.SetReadTimestamps(dbs.readAt1, dbs.readAt2)
+	if err := jd.Write(rd, changesFor); err != nil {
+		return err
+	}
+	return nil
+}
+
+// showTableOnlyOn writes the table existing only on the database labeled onlyOn, whose rows are not compared.
+// It is logged for the formats which cannot express it.
+func showTableOnlyOn(c *cli.Context, w io.Writer, table, onlyOn string, dbs *databases, keyColumns int, report *spandbcompare.HTMLReport) error {
+	changesFor, err := changesFor(c, string(dbs.dsn1), string(dbs.dsn2))
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		report.AddTableOnlyOn(table, onlyOn)
+	}
+	switch difftype := c.GlobalString("difftype"); difftype {
+	case "json", "jsonl":
+		newJSONDiff := spandbcompare.NewJSONDiff
+		if difftype == "jsonl" {
+			newJSONDiff = spandbcompare.NewJSONLinesDiff
+		}
+		jd, err := newJSONDiff(w, table, string(dbs.dsn1), string(dbs.dsn2))
+		if err != nil {
+			return err
+		}
+		jd.SetReadTimestamps(dbs.readAt1, dbs.readAt2)
+		return jd.WriteTableOnlyOn(onlyOn, changesFor)
+	case "csv", "tsv":
+		cd, err := newCSVDiff(c, w, table, string(dbs.dsn1), string(dbs.dsn2), keyColumns)
+		if err != nil {
+			return err
+		}
+		return cd.WriteTableOnlyOn(onlyOn, changesFor)
+	}
+	log.Printf("table %s exists only on %s, skipped", table, onlyOn)
+	return nil
+}
+
+// streamJSONLines compares the rows of the table and writes the differences as JSON Lines as soon as they are found,
+// without holding them in memory unless the HTML report needs them
+func streamJSONLines(ctx context.Context, c *cli.Context, w io.Writer, dbs *databases, table string, stats *diffStats, report *spandbcompare.HTMLReport) error {
+	changesFor, err := changesFor(c, string(dbs.dsn1), string(dbs.dsn2))
+	if err != nil {
+		return err
+	}
+	jd, err := spandbcompare.NewJSONLinesDiff(w, table, string(dbs.dsn1), string(dbs.dsn2))
+	if err != nil {
+		return err
+	}
+	jd.SetReadTimestamps(dbs.readAt1, dbs.readAt2)
+	jh, err := jd.LinesHandler(changesFor)
+	if err != nil {
+		return err
+	}
+
+	hs := []spandbcompare.RowsDiffHandler{jh, stats}
+	var rd *spandbcompare.RowsDiff
+	if report != nil {
+		rd = &spandbcompare.RowsDiff{}
+		hs = append(hs, rd)
+	}
+	cns, err := dbs.streamRows(ctx, c, table, spandbcompare.MultiRowsDiffHandler(hs...))
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		rd.Columns = cns
+		report.AddTable(table, cns, rd)
+	}
+	return jh.WriteSummary()
+}
+
+func newCSVDiff(c *cli.Context, w io.Writer, table, label1, label2 string, keyColumns int) (*spandbcompare.CSVDiff, error) {
+	if c.GlobalString("difftype") == "tsv" {
+		return spandbcompare.NewTSVDiff(w, table, label1, label2, keyColumns)
+	}
+	return spandbcompare.NewCSVDiff(w, table, label1, label2, keyColumns)
+}
+
+func showCSVDiff(c *cli.Context, w io.Writer, rd *spandbcompare.RowsDiff, table, label1, label2 string, keyColumns int) error {
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return err
+	}
+
+	cd, err := newCSVDiff(c, w, table, label1, label2, keyColumns)
+	if err != nil {
+		return err
+	}
+	if err := cd.Write(rd, changesFor); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeHTMLReport(c *cli.Context, report *spandbcompare.HTMLReport, label1, label2 string) error {
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(c.GlobalString("html-report"))
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f, changesFor); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func showSchemaDiff(ctx context.Context, c *cli.Context, c1, c2 *spanner.Client, filter *spandbcompare.TableFilter, label1, label2 string) (*spandbcompare.SchemaDiff, error) {
+	changesFor, err := changesFor(c, label1, label2)
+	if err != nil {
+		return nil, err
+	}
+
+	s1, err := spandbcompare.LoadSchema(ctx, c1)
+	if err != nil {
+		return nil, err
+	}
+	s2, err := spandbcompare.LoadSchema(ctx, c2)
+	if err != nil {
+		return nil, err
+	}
+	sd := spandbcompare.CompareSchemas(filter.FilterSchema(s1), filter.FilterSchema(s2))
+
+	if c.GlobalString("difftype") == "sql" {
+		dd, err := spandbcompare.NewDDLDiff(sd, label1, label2)
+		if err != nil {
+			return nil, err
+		}
+		unsupported, err := dd.UnsupportedChanges(changesFor)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range unsupported {
+			fmt.Fprintf(c.App.Writer, "-- unsupported: %s\n", msg)
+		}
+		ddls, err := dd.DDL(changesFor)
+		if err != nil {
+			return nil, err
+		}
+		for _, ddl := range ddls {
+			fmt.Fprintln(c.App.Writer, ddl)
+		}
+		return sd, nil
+	}
+
+	ud, err := spandbcompare.NewUnifiedSchemaDiff(c.App.Writer, label1, label2)
+	if err != nil {
+		return nil, err
+	}
+	if err := ud.Write(sd, changesFor); err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
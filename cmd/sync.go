@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	spandbcompare "github.com/castaneai/spandbcompare/pkg"
+	"github.com/urfave/cli"
+)
+
+var syncCommand = cli.Command{
+	Name:      "sync",
+	Usage:     "Apply the differences of rows to the database of --changes-for to make it the same as the other",
+	UsageText: fmt.Sprintf("%s [global options] sync [options]", Name),
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print the mutations to apply without applying them",
+		},
+		cli.BoolFlag{
+			Name:  "yes",
+			Usage: "Apply the mutations without confirmation",
+		},
+		cli.IntFlag{
+			Name:  "max-mutations-per-commit",
+			Usage: "The maximum number of mutations (columns of inserted and updated rows, and deleted rows) in a commit, which must be lower than the limit of Spanner (20000) including secondary indexes",
+			Value: 10000,
+		},
+	},
+	Action: cmdSync,
+}
+
+func cmdSync(c *cli.Context) error {
+	ctx := context.Background()
+	dbs, err := openDatabases(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer dbs.Close()
+
+	mode := c.GlobalString("mode")
+	if mode != "full" && mode != "checksum" {
+		return fmt.Errorf("mode must be 'full' or 'checksum' to sync")
+	}
+	if err := validatePartitions(c, mode); err != nil {
+		return err
+	}
+	if c.Int("max-mutations-per-commit") < 1 {
+		return fmt.Errorf("max-mutations-per-commit must be positive")
+	}
+	target, err := changesFor(c, string(dbs.dsn1), string(dbs.dsn2))
+	if err != nil {
+		return err
+	}
+	client := dbs.c1
+	if target == string(dbs.dsn2) {
+		client = dbs.c2
+	}
+
+	if err := dbs.prepare(ctx, c); err != nil {
+		return err
+	}
+	writeReadTimestamps(c.App.Writer, "", dbs)
+	td, err := dbs.tables(ctx)
+	if err != nil {
+		return err
+	}
+	dbs.logSkippedTables(td)
+
+	var mu sync.Mutex
+	tableMutations := make(map[string][]*spandbcompare.Mutation)
+	if err := spandbcompare.CompareTables(ctx, td.CommonTables, c.GlobalInt("parallelism"), c.App.Writer, func(ctx context.Context, table string, w io.Writer) error {
+		_, rd, err := dbs.compareRows(ctx, c, table)
+		if err != nil {
+			return err
+		}
+		md, err := spandbcompare.NewMutationDiff(rd, table, string(dbs.dsn1), string(dbs.dsn2))
+		if err != nil {
+			return err
+		}
+		ms, err := md.Mutations(target)
+		if err != nil {
+			return err
+		}
+		inserts, updates, deletes := countMutations(ms)
+		fmt.Fprintf(w, "%s: %d rows to insert, %d rows to update, %d rows to delete\n", table, inserts, updates, deletes)
+		mu.Lock()
+		defer mu.Unlock()
+		tableMutations[table] = ms
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var ms []*spandbcompare.Mutation
+	for _, table := range td.CommonTables {
+		ms = append(ms, tableMutations[table]...)
+	}
+	if len(ms) < 1 {
+		fmt.Fprintln(c.App.Writer, "No diff found")
+		return nil
+	}
+	schema, err := spandbcompare.LoadSchema(ctx, client)
+	if err != nil {
+		return err
+	}
+	ms = spandbcompare.SortMutations(ms, schema)
+
+	if c.Bool("dry-run") {
+		return spandbcompare.WriteMutations(c.App.Writer, ms)
+	}
+	if !c.Bool("yes") {
+		ok, err := confirm(fmt.Sprintf("Apply the changes to %s?", target))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("sync aborted")
+		}
+	}
+
+	if err := applyMutations(ctx, client, ms, c.Int("max-mutations-per-commit")); err != nil {
+		return err
+	}
+	inserts, updates, deletes := countMutations(ms)
+	fmt.Fprintf(c.App.Writer, "%d rows inserted, %d rows updated, %d rows deleted on %s\n", inserts, updates, deletes, target)
+	return nil
+}
+
+func countMutations(ms []*spandbcompare.Mutation) (inserts, updates, deletes int) {
+	for _, m := range ms {
+		switch m.Op {
+		case spandbcompare.MutationInsertOrUpdate:
+			inserts++
+		case spandbcompare.MutationUpdate:
+			updates++
+		case spandbcompare.MutationDelete:
+			deletes++
+		}
+	}
+	return
+}
+
+// applyMutations applies the mutations in read-write transactions of at most maxCount mutations.
+// The batches committed before an error are not rolled back.
+func applyMutations(ctx context.Context, client *spanner.Client, ms []*spandbcompare.Mutation, maxCount int) error {
+	batches := spandbcompare.BatchMutations(ms, maxCount)
+	for i, batch := range batches {
+		sms, err := spandbcompare.SpannerMutations(batch)
+		if err != nil {
+			return err
+		}
+		if _, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+			return tx.BufferWrite(sms)
+		}); err != nil {
+			return fmt.Errorf("failed to apply batch %d/%d: %v", i+1, len(batches), err)
+		}
+		log.Printf("applied batch %d/%d (%d rows)", i+1, len(batches), len(batch))
+	}
+	return nil
+}
+
+// confirm asks yes or no on the terminal
+func confirm(msg string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", msg)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/urfave/cli"
+)
+
+// timestampBounds returns the timestamp bounds to read server1 and server2.
+// The bounds of --same-timestamp are resolved by sameReadTimestamp after connecting to server1.
+func timestampBounds(c *cli.Context) (spanner.TimestampBound, spanner.TimestampBound, error) {
+	exactStaleness := c.GlobalDuration("exact-staleness")
+	maxStaleness := c.GlobalDuration("max-staleness")
+	if exactStaleness > 0 && maxStaleness > 0 {
+		return spanner.TimestampBound{}, spanner.TimestampBound{}, fmt.Errorf("exact-staleness and max-staleness cannot be used together")
+	}
+
+	tb1, tb2 := spanner.StrongRead(), spanner.StrongRead()
+	switch {
+	case exactStaleness > 0:
+		tb1, tb2 = spanner.ExactStaleness(exactStaleness), spanner.ExactStaleness(exactStaleness)
+	case maxStaleness > 0:
+		tb1, tb2 = spanner.MaxStaleness(maxStaleness), spanner.MaxStaleness(maxStaleness)
+	}
+
+	if c.GlobalBool("same-timestamp") && maxStaleness > 0 {
+		return spanner.TimestampBound{}, spanner.TimestampBound{}, fmt.Errorf("same-timestamp cannot be used with max-staleness")
+	}
+
+	for i, name := range []string{"read-timestamp", "read-timestamp1", "read-timestamp2"} {
+		s := c.GlobalString(name)
+		if s == "" {
+			continue
+		}
+		if exactStaleness > 0 || maxStaleness > 0 || c.GlobalBool("same-timestamp") {
+			return spanner.TimestampBound{}, spanner.TimestampBound{}, fmt.Errorf("%s cannot be used with staleness or same-timestamp", name)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return spanner.TimestampBound{}, spanner.TimestampBound{}, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		switch i {
+		case 0:
+			tb1, tb2 = spanner.ReadTimestamp(ts), spanner.ReadTimestamp(ts)
+		case 1:
+			tb1 = spanner.ReadTimestamp(ts)
+		case 2:
+			tb2 = spanner.ReadTimestamp(ts)
+		}
+	}
+	return tb1, tb2, nil
+}
+
+// sameReadTimestamp returns the timestamp to read both servers for --same-timestamp, staleness before now on server1.
+// The timestamp is taken from a strong read on server1 rather than the local clock, which may be skewed.
+func sameReadTimestamp(ctx context.Context, client *spanner.Client, staleness time.Duration) (time.Time, error) {
+	tx, ts, err := beginSnapshot(ctx, client, spanner.StrongRead())
+	if err != nil {
+		return time.Time{}, err
+	}
+	tx.Close()
+	return ts.Add(-staleness), nil
+}
+
+// beginSnapshot starts a read-only transaction and returns it with its read timestamp
+func beginSnapshot(ctx context.Context, client *spanner.Client, tb spanner.TimestampBound) (*spanner.ReadOnlyTransaction, time.Time, error) {
+	tx := client.ReadOnlyTransaction().WithTimestampBound(tb)
+	// the read timestamp is chosen by the first read in the transaction
+	if err := tx.Query(ctx, spanner.NewStatement("SELECT 1")).Do(func(r *spanner.Row) error { return nil }); err != nil {
+		tx.Close()
+		return nil, time.Time{}, err
+	}
+	ts, err := tx.Timestamp()
+	if err != nil {
+		tx.Close()
+		return nil, time.Time{}, err
+	}
+	return tx, ts, nil
+}
+
+// describeTimestampBound describes the timestamp bound for the report, e.g. "strong" or "exactStaleness: 15s"
+func describeTimestampBound(tb spanner.TimestampBound) string {
+	return strings.Trim(tb.String(), "()")
+}
+
+// writeReadTimestamps writes the read timestamps of the servers as comment lines starting with the prefix
+func writeReadTimestamps(w io.Writer, prefix string, dbs *databases) {
+	fmt.Fprintf(w, "%sread timestamp of %s: %s\n", prefix, dbs.dsn1, dbs.readAt1)
+	fmt.Fprintf(w, "%sread timestamp of %s: %s\n", prefix, dbs.dsn2, dbs.readAt2)
+}
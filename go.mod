@@ -4,9 +4,11 @@ go 1.12
 
 require (
 	cloud.google.com/go v0.49.0
+	cloud.google.com/go/spanner v1.1.0
 	github.com/castaneai/spankeys v0.0.0-20200129071327-7f6b10d772b8
 	github.com/fatih/color v1.7.0
 	github.com/stretchr/testify v1.4.0
 	github.com/urfave/cli v1.22.1
 	golang.org/x/build v0.0.0-20190111050920-041ab4dc3f9d // indirect
+	google.golang.org/api v0.14.0
 )
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// BucketChecksum is the aggregated hash of the rows in a bucket
+type BucketChecksum struct {
+	Bucket   int64
+	Count    int64
+	Checksum int64
+}
+
+// bucketExpr assigns rows to buckets by the hash of the whole primary key,
+// so that the rows spread over the buckets even when they share a key prefix.
+func (s *DataSource) bucketExpr() string {
+	return fmt.Sprintf("ABS(MOD(%s, @buckets))", rowHashExpr(s.pkColNames))
+}
+
+// rowHashExpr hashes a canonical serialization of the columns.
+// FORMAT('%T') renders each value as a literal, so NULL, strings and bytes are distinguishable.
+func rowHashExpr(columns []string) string {
+	var fmts []string
+	for range columns {
+		fmts = append(fmts, "%T")
+	}
+	return fmt.Sprintf("FARM_FINGERPRINT(FORMAT('%s', %s))", strings.Join(fmts, "|"), quoteIdentifiers(columns))
+}
+
+// Checksums computes the checksum of the rows in each bucket on the server side.
+// Only the buckets containing rows are returned.
+func (s *DataSource) Checksums(ctx context.Context, columns []string, buckets int) (map[int64]*BucketChecksum, error) {
+	if len(s.pkColNames) < 1 {
+		return nil, fmt.Errorf("at least one of Primary Key is required")
+	}
+	if len(columns) < 1 {
+		return nil, fmt.Errorf("at least one column is required to compute checksums")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("SELECT %s AS bucket, COUNT(*) AS cnt, BIT_XOR(%s) AS checksum FROM `%s` GROUP BY bucket",
+			s.bucketExpr(), rowHashExpr(columns), s.table),
+		Params: map[string]interface{}{"buckets": int64(buckets)},
+	}
+	cs := make(map[int64]*BucketChecksum)
+	if err := s.query(ctx, stmt).Do(func(r *spanner.Row) error {
+		bc := &BucketChecksum{}
+		if err := r.Columns(&bc.Bucket, &bc.Count, &bc.Checksum); err != nil {
+			return err
+		}
+		cs[bc.Bucket] = bc
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// RowIteratorInBuckets returns the rows in the buckets ordered by the primary key
+func (s *DataSource) RowIteratorInBuckets(ctx context.Context, buckets int, ids []int64) RowIterator {
+	stmt := spanner.Statement{
+		SQL:    fmt.Sprintf("SELECT * FROM `%s` WHERE %s IN UNNEST(@ids) ORDER BY %s", s.table, s.bucketExpr(), s.orderByPrimaryKey()),
+		Params: map[string]interface{}{"buckets": int64(buckets), "ids": ids},
+	}
+	return s.rowIterator(ctx, stmt)
+}
+
+// DiffBuckets returns the buckets whose checksums differ, in ascending order
+func DiffBuckets(cs1, cs2 map[int64]*BucketChecksum) []int64 {
+	var ids []int64
+	for id, bc1 := range cs1 {
+		bc2, exists2 := cs2[id]
+		if !exists2 || bc1.Count != bc2.Count || bc1.Checksum != bc2.Checksum {
+			ids = append(ids, id)
+		}
+	}
+	for id := range cs2 {
+		if _, exists1 := cs1[id]; !exists1 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// CompareByChecksum compares the bucket checksums computed by each server first,
+// and then downloads and compares only the rows in the differing buckets.
+// The checksums are computed over the given columns, so ignored columns should be excluded to avoid needless downloads.
+func CompareByChecksum(ctx context.Context, ds1, ds2 *DataSource, cmp RowComparator, columns []string, buckets int, h RowsDiffHandler) error {
+	cs1, err := ds1.Checksums(ctx, columns, buckets)
+	if err != nil {
+		return err
+	}
+	cs2, err := ds2.Checksums(ctx, columns, buckets)
+	if err != nil {
+		return err
+	}
+	ids := DiffBuckets(cs1, cs2)
+	if len(ids) < 1 {
+		return nil
+	}
+	return CompareRowIteratorsInOrder(ds1.RowIteratorInBuckets(ctx, buckets, ids), ds2.RowIteratorInBuckets(ctx, buckets, ids), ds1.KeyOrder(), cmp, h)
+}
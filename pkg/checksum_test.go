@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffBuckets(t *testing.T) {
+	cs1 := map[int64]*BucketChecksum{
+		0: {Bucket: 0, Count: 10, Checksum: 100},
+		1: {Bucket: 1, Count: 10, Checksum: 200},
+		2: {Bucket: 2, Count: 10, Checksum: 300},
+		4: {Bucket: 4, Count: 1, Checksum: 500},
+	}
+	cs2 := map[int64]*BucketChecksum{
+		0: {Bucket: 0, Count: 10, Checksum: 100},
+		1: {Bucket: 1, Count: 10, Checksum: 201},
+		2: {Bucket: 2, Count: 11, Checksum: 300},
+		3: {Bucket: 3, Count: 1, Checksum: 400},
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, DiffBuckets(cs1, cs2))
+	assert.Equal(t, 0, len(DiffBuckets(cs1, cs1)))
+}
+
+func TestRowHashExpr(t *testing.T) {
+	assert.Equal(t, "FARM_FINGERPRINT(FORMAT('%T|%T', `id`, `name`))", rowHashExpr([]string{"id", "name"}))
+}
+
+func TestBucketExpr(t *testing.T) {
+	ds := &DataSource{pkColNames: []string{"SingerId", "AlbumId"}}
+	assert.Equal(t, "ABS(MOD(FARM_FINGERPRINT(FORMAT('%T|%T', `SingerId`, `AlbumId`)), @buckets))", ds.bucketExpr())
+}
@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
+
+	"google.golang.org/api/iterator"
 )
 
 type RowComparator interface {
@@ -12,6 +15,16 @@ type RowComparator interface {
 
 type DefaultRowComparator struct {
 	IgnoreColumns []string
+	// FloatTolerance applies to FLOAT64 columns not listed in ColumnFloatTolerances
+	FloatTolerance        FloatTolerance
+	ColumnFloatTolerances map[string]FloatTolerance
+	NaN                   NaNPolicy
+	SignedZero            SignedZeroPolicy
+	// TimestampTolerance and TimestampTruncation apply to TIMESTAMP columns not listed in the per-column maps
+	TimestampTolerance         time.Duration
+	TimestampTruncation        time.Duration
+	ColumnTimestampTolerances  map[string]time.Duration
+	ColumnTimestampTruncations map[string]time.Duration
 }
 
 func (cmp *DefaultRowComparator) Compare(row1, row2 *Row) (*RowDiff, error) {
@@ -50,7 +63,7 @@ func (cmp *DefaultRowComparator) Compare(row1, row2 *Row) (*RowDiff, error) {
 			irow1.ColumnValues[cn] = cv1
 			continue
 		}
-		if !cmp.CompareValues(cv1, cv2) {
+		if !cmp.valueComparator(cn).Equal(cv1, cv2) {
 			irow1.ColumnValues[cn] = cv1
 			irow2.ColumnValues[cn] = cv2
 		}
@@ -67,7 +80,27 @@ func (cmp *DefaultRowComparator) Compare(row1, row2 *Row) (*RowDiff, error) {
 }
 
 func (cmp *DefaultRowComparator) CompareValues(v1, v2 interface{}) bool {
-	return fmt.Sprintf("%s", v1) == fmt.Sprintf("%s", v2)
+	return cmp.valueComparator("").Equal(v1, v2)
+}
+
+func (cmp *DefaultRowComparator) valueComparator(column string) *ValueComparator {
+	vc := &ValueComparator{
+		FloatTolerance:      cmp.FloatTolerance,
+		NaN:                 cmp.NaN,
+		SignedZero:          cmp.SignedZero,
+		TimestampTolerance:  cmp.TimestampTolerance,
+		TimestampTruncation: cmp.TimestampTruncation,
+	}
+	if ft, ok := cmp.ColumnFloatTolerances[column]; ok {
+		vc.FloatTolerance = ft
+	}
+	if tt, ok := cmp.ColumnTimestampTolerances[column]; ok {
+		vc.TimestampTolerance = tt
+	}
+	if tt, ok := cmp.ColumnTimestampTruncations[column]; ok {
+		vc.TimestampTruncation = tt
+	}
+	return vc
 }
 
 type RowDiff struct {
@@ -76,9 +109,21 @@ type RowDiff struct {
 	Row2       *Row
 }
 
+// CompareRows compares the rows in memory and returns the differences ordered by the primary key ascending
 func CompareRows(rows1, rows2 []*Row, cmp RowComparator) (*RowsDiff, error) {
-	rows1Map := rowsToPKMap(rows1)
-	rows2Map := rowsToPKMap(rows2)
+	return CompareRowsInOrder(rows1, rows2, nil, cmp)
+}
+
+// CompareRowsInOrder is CompareRows returning the differences ordered by the primary key in the order, such as DataSource.KeyOrder
+func CompareRowsInOrder(rows1, rows2 []*Row, order KeyOrder, cmp RowComparator) (*RowsDiff, error) {
+	rows1Map, err := rowsToPKMap(rows1)
+	if err != nil {
+		return nil, err
+	}
+	rows2Map, err := rowsToPKMap(rows2)
+	if err != nil {
+		return nil, err
+	}
 
 	df := &RowsDiff{}
 	for pks, row1 := range rows1Map {
@@ -100,14 +145,167 @@ func CompareRows(rows1, rows2 []*Row, cmp RowComparator) (*RowsDiff, error) {
 			df.Rows2Only = append(df.Rows2Only, row2)
 		}
 	}
+	// the order of map iteration is random
+	if err := df.Sort(order); err != nil {
+		return nil, err
+	}
 	return df, nil
 }
 
-func rowsToPKMap(rows []*Row) map[string]*Row {
+// rowsToPKMap maps the rows by the encoded primary keys
+func rowsToPKMap(rows []*Row) (map[string]*Row, error) {
 	pkmap := make(map[string]*Row, len(rows))
 	for _, row := range rows {
-		pks := row.PrimaryKey().String()
+		pks, err := row.PrimaryKey().Encode()
+		if err != nil {
+			return nil, err
+		}
 		pkmap[pks] = row
 	}
-	return pkmap
+	return pkmap, nil
+}
+
+// RowIterator iterates rows ordered by the primary key.
+// Next returns iterator.Done when there are no more rows.
+type RowIterator interface {
+	Next() (*Row, error)
+	Stop()
+}
+
+// RowsDiffHandler receives differences found by CompareRowIterators one by one.
+type RowsDiffHandler interface {
+	OnRows1Only(row *Row) error
+	OnRows2Only(row *Row) error
+	OnDiffRow(rd *RowDiff) error
+}
+
+// MultiRowsDiffHandler returns a RowsDiffHandler passing each difference to all the handlers in order
+func MultiRowsDiffHandler(hs ...RowsDiffHandler) RowsDiffHandler {
+	return multiRowsDiffHandler(hs)
+}
+
+type multiRowsDiffHandler []RowsDiffHandler
+
+func (m multiRowsDiffHandler) OnRows1Only(row *Row) error {
+	for _, h := range m {
+		if err := h.OnRows1Only(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiRowsDiffHandler) OnRows2Only(row *Row) error {
+	for _, h := range m {
+		if err := h.OnRows2Only(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiRowsDiffHandler) OnDiffRow(rd *RowDiff) error {
+	for _, h := range m {
+		if err := h.OnDiffRow(rd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompareRowIterators compares two streams of rows by merge-joining them on the primary key.
+// Both iterators must return rows ordered by the primary key ascending.
+// Unlike CompareRows, only the current row of each side is held in memory.
+func CompareRowIterators(it1, it2 RowIterator, cmp RowComparator, h RowsDiffHandler) error {
+	return CompareRowIteratorsInOrder(it1, it2, nil, cmp, h)
+}
+
+// CompareRowIteratorsInOrder is CompareRowIterators for the rows ordered by the primary key in the order,
+// such as the rows of DataSource.RowIterator in DataSource.KeyOrder.
+func CompareRowIteratorsInOrder(it1, it2 RowIterator, order KeyOrder, cmp RowComparator, h RowsDiffHandler) error {
+	defer it1.Stop()
+	defer it2.Stop()
+
+	r1 := &orderedRowIterator{RowIterator: it1, order: order}
+	r2 := &orderedRowIterator{RowIterator: it2, order: order}
+	row1, err := r1.Next()
+	if err != nil {
+		return err
+	}
+	row2, err := r2.Next()
+	if err != nil {
+		return err
+	}
+	for row1 != nil || row2 != nil {
+		c := 0
+		if row1 != nil && row2 != nil {
+			c, err = order.Compare(row1.PrimaryKey(), row2.PrimaryKey())
+			if err != nil {
+				return err
+			}
+		}
+		switch {
+		case row2 == nil || (row1 != nil && c < 0):
+			if err := h.OnRows1Only(row1); err != nil {
+				return err
+			}
+			if row1, err = r1.Next(); err != nil {
+				return err
+			}
+		case row1 == nil || c > 0:
+			if err := h.OnRows2Only(row2); err != nil {
+				return err
+			}
+			if row2, err = r2.Next(); err != nil {
+				return err
+			}
+		default:
+			rd, err := cmp.Compare(row1, row2)
+			if err != nil {
+				return err
+			}
+			if rd != nil {
+				if err := h.OnDiffRow(rd); err != nil {
+					return err
+				}
+			}
+			if row1, err = r1.Next(); err != nil {
+				return err
+			}
+			if row2, err = r2.Next(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// orderedRowIterator returns nil row instead of iterator.Done at the end,
+// and verifies that the rows are strictly ordered by the primary key.
+type orderedRowIterator struct {
+	RowIterator
+	order KeyOrder
+	last  PrimaryKey
+}
+
+func (it *orderedRowIterator) Next() (*Row, error) {
+	row, err := it.RowIterator.Next()
+	if err == iterator.Done {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pk := row.PrimaryKey()
+	if it.last != nil {
+		c, err := it.order.Compare(it.last, pk)
+		if err != nil {
+			return nil, err
+		}
+		if c >= 0 {
+			return nil, fmt.Errorf("rows are not ordered by the primary key (%s after %s)", pk, it.last)
+		}
+	}
+	it.last = pk
+	return row, nil
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
 )
 
 func TestCompare_NoDiff(t *testing.T) {
@@ -127,3 +128,203 @@ func TestCompare_DiffWithIgnoreColumns(t *testing.T) {
 		assert.NotContains(t, diff.DiffRows[0].Row2.ColumnValues, "age")
 	}
 }
+
+type sliceRowIterator struct {
+	rows []*Row
+}
+
+func (it *sliceRowIterator) Next() (*Row, error) {
+	if len(it.rows) < 1 {
+		return nil, iterator.Done
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, nil
+}
+
+func (it *sliceRowIterator) Stop() {}
+
+func TestCompareRowIterators(t *testing.T) {
+	pks := []string{"id"}
+	rows1 := []*Row{
+		{pks, map[string]ColumnValue{"id": int64(1), "name": "a"}},
+		{pks, map[string]ColumnValue{"id": int64(2), "name": "b"}},
+		{pks, map[string]ColumnValue{"id": int64(4), "name": "d"}},
+		{pks, map[string]ColumnValue{"id": int64(10), "name": "j"}},
+	}
+	rows2 := []*Row{
+		{pks, map[string]ColumnValue{"id": int64(2), "name": "b"}},
+		{pks, map[string]ColumnValue{"id": int64(3), "name": "c"}},
+		{pks, map[string]ColumnValue{"id": int64(4), "name": "d-alt"}},
+	}
+	diff := &RowsDiff{}
+	if err := CompareRowIterators(&sliceRowIterator{rows1}, &sliceRowIterator{rows2}, &DefaultRowComparator{}, diff); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, diff.HasDiff())
+	assert.Equal(t, 2, len(diff.Rows1Only))
+	assert.Equal(t, int64(1), diff.Rows1Only[0].ColumnValues["id"])
+	assert.Equal(t, int64(10), diff.Rows1Only[1].ColumnValues["id"])
+	assert.Equal(t, 1, len(diff.Rows2Only))
+	assert.Equal(t, int64(3), diff.Rows2Only[0].ColumnValues["id"])
+	assert.Equal(t, 1, len(diff.DiffRows))
+	assert.Equal(t, "d", diff.DiffRows[0].Row1.ColumnValues["name"])
+	assert.Equal(t, "d-alt", diff.DiffRows[0].Row2.ColumnValues["name"])
+}
+
+func TestCompareRowIterators_Unordered(t *testing.T) {
+	pks := []string{"id"}
+	rows1 := []*Row{
+		{pks, map[string]ColumnValue{"id": "b"}},
+		{pks, map[string]ColumnValue{"id": "a"}},
+	}
+	err := CompareRowIterators(&sliceRowIterator{rows1}, &sliceRowIterator{}, &DefaultRowComparator{}, &RowsDiff{})
+	assert.Error(t, err)
+}
+
+func TestCompare_DiffWithFloatTolerance(t *testing.T) {
+	pks := []string{"id"}
+	rows1 := []*Row{{pks, map[string]ColumnValue{"id": "a", "price": 100.0, "rate": 0.5}}}
+	rows2 := []*Row{{pks, map[string]ColumnValue{"id": "a", "price": 100.001, "rate": 0.5000001}}}
+
+	{
+		diff, err := CompareRows(rows1, rows2, &DefaultRowComparator{FloatTolerance: FloatTolerance{Absolute: 1e-6}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, len(diff.DiffRows))
+		assert.Contains(t, diff.DiffRows[0].Row1.ColumnValues, "price")
+		assert.NotContains(t, diff.DiffRows[0].Row1.ColumnValues, "rate")
+	}
+
+	{
+		diff, err := CompareRows(rows1, rows2, &DefaultRowComparator{
+			FloatTolerance:        FloatTolerance{Absolute: 1e-6},
+			ColumnFloatTolerances: map[string]FloatTolerance{"price": {Relative: 1e-4}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, false, diff.HasDiff())
+	}
+}
+
+func TestCompareRows_Sorted(t *testing.T) {
+	pks := []string{"id"}
+	var rows1, rows2 []*Row
+	for _, id := range []int64{5, 3, 9, 1, 7} {
+		rows1 = append(rows1, &Row{pks, map[string]ColumnValue{"id": id, "name": "a"}})
+		rows2 = append(rows2, &Row{pks, map[string]ColumnValue{"id": id + 1, "name": "b"}})
+	}
+	diff, err := CompareRows(rows1, rows2, &DefaultRowComparator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, row := range diff.Rows1Only {
+		ids = append(ids, row.ColumnValues["id"].(int64))
+	}
+	assert.Equal(t, []int64{1, 3, 5, 7, 9}, ids)
+
+	diff, err = CompareRowsInOrder(rows1, rows2, KeyOrder{true}, &DefaultRowComparator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	for _, row := range diff.Rows2Only {
+		ids = append(ids, row.ColumnValues["id"].(int64))
+	}
+	assert.Equal(t, []int64{10, 8, 6, 4, 2}, ids)
+}
+
+func TestCompareRowIteratorsInOrder(t *testing.T) {
+	pks := []string{"a", "b"}
+	rows1 := []*Row{
+		{pks, map[string]ColumnValue{"a": int64(1), "b": "z", "v": 1}},
+		{pks, map[string]ColumnValue{"a": int64(1), "b": "x", "v": 1}},
+		{pks, map[string]ColumnValue{"a": int64(2), "b": "y", "v": 1}},
+	}
+	rows2 := []*Row{
+		{pks, map[string]ColumnValue{"a": int64(1), "b": "y", "v": 1}},
+		{pks, map[string]ColumnValue{"a": int64(1), "b": "x", "v": 2}},
+	}
+	order := KeyOrder{false, true}
+	diff := &RowsDiff{}
+	if err := CompareRowIteratorsInOrder(&sliceRowIterator{rows1}, &sliceRowIterator{rows2}, order, &DefaultRowComparator{}, diff); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(diff.Rows1Only))
+	assert.Equal(t, 1, len(diff.Rows2Only))
+	assert.Equal(t, 1, len(diff.DiffRows))
+
+	// the rows in DESC order are not ordered ascending
+	err := CompareRowIterators(&sliceRowIterator{rows1}, &sliceRowIterator{}, &DefaultRowComparator{}, &RowsDiff{})
+	assert.Error(t, err)
+}
+
+func TestRowsDiff_Sort(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{}
+	for _, id := range []interface{}{"b", nil, "c", "a"} {
+		rd.Rows1Only = append(rd.Rows1Only, &Row{pks, map[string]ColumnValue{"id": id}})
+	}
+	if err := rd.Sort(KeyOrder{true}); err != nil {
+		t.Fatal(err)
+	}
+	var ids []interface{}
+	for _, row := range rd.Rows1Only {
+		ids = append(ids, row.ColumnValues["id"])
+	}
+	// NULL is the smallest value, so it is the last in DESC order
+	assert.Equal(t, []interface{}{"c", "b", "a", nil}, ids)
+}
+
+func TestOrderedColumns(t *testing.T) {
+	values := map[string]ColumnValue{"name": 1, "id": 2, "extra2": 3, "extra1": 4}
+	assert.Equal(t, []string{"id", "name", "extra1", "extra2"}, orderedColumns([]string{"id", "age", "name"}, values))
+	assert.Equal(t, []string{"extra1", "extra2", "id", "name"}, orderedColumns(nil, values))
+}
+
+func TestCompareRows_CollidingKeyStrings(t *testing.T) {
+	pks := []string{"id1", "id2"}
+	rows1 := []*Row{
+		{pks, map[string]ColumnValue{"id1": "a_b", "id2": "c", "name": "x"}},
+		{pks, map[string]ColumnValue{"id1": "a", "id2": "b_c", "name": "y"}},
+	}
+	rows2 := []*Row{
+		{pks, map[string]ColumnValue{"id1": "a", "id2": "b_c", "name": "y"}},
+		{pks, map[string]ColumnValue{"id1": "a_b", "id2": "c", "name": "x"}},
+	}
+	diff, err := CompareRows(rows1, rows2, &DefaultRowComparator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, diff.HasDiff())
+
+	nullRows := []*Row{{[]string{"id"}, map[string]ColumnValue{"id": nil}}}
+	strRows := []*Row{{[]string{"id"}, map[string]ColumnValue{"id": "<nil>"}}}
+	diff, err = CompareRows(nullRows, strRows, &DefaultRowComparator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(diff.Rows1Only))
+	assert.Equal(t, 1, len(diff.Rows2Only))
+}
+
+func TestMultiRowsDiffHandler(t *testing.T) {
+	pks := []string{"id"}
+	rd1, rd2 := &RowsDiff{}, &RowsDiff{}
+	h := MultiRowsDiffHandler(rd1, rd2)
+	row := &Row{pks, map[string]ColumnValue{"id": "a"}}
+	if err := h.OnRows1Only(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.OnRows2Only(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.OnDiffRow(&RowDiff{[]interface{}{"a"}, row, row}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rd1, rd2)
+	assert.Equal(t, 1, len(rd1.DiffRows))
+}
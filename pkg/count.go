@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// TableCount is the number of rows of a table on two databases.
+// Exists1 or Exists2 is false if the table does not exist on the database.
+type TableCount struct {
+	Table   string
+	Count1  int64
+	Count2  int64
+	Exists1 bool
+	Exists2 bool
+}
+
+// CountRows counts the rows of the table with ds1 and ds2. nil DataSource means the table does not exist on the database.
+func CountRows(ctx context.Context, table string, ds1, ds2 *DataSource) (*TableCount, error) {
+	tc := &TableCount{Table: table, Exists1: ds1 != nil, Exists2: ds2 != nil}
+	var err error
+	if ds1 != nil {
+		if tc.Count1, err = ds1.Count(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if ds2 != nil {
+		if tc.Count2, err = ds2.Count(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return tc, nil
+}
+
+// Delta returns the number of rows on the second database minus that on the first
+func (tc *TableCount) Delta() int64 {
+	return tc.Count2 - tc.Count1
+}
+
+// Match reports whether the table exists on both databases with the same number of rows
+func (tc *TableCount) Match() bool {
+	return tc.Exists1 && tc.Exists2 && tc.Count1 == tc.Count2
+}
+
+// CountReport writes TableCount as tab-separated lines of the table, the counts, the delta and OK or MISMATCH.
+// The count of a table which does not exist on the database is "-".
+type CountReport struct {
+	w          io.Writer
+	rows1Label string
+	rows2Label string
+}
+
+func NewCountReport(w io.Writer, rows1Label, rows2Label string) (*CountReport, error) {
+	return &CountReport{
+		w:          w,
+		rows1Label: rows1Label,
+		rows2Label: rows2Label,
+	}, nil
+}
+
+// WriteHeader writes the header line, which should be written once before the tables
+func (r *CountReport) WriteHeader() error {
+	_, err := fmt.Fprintf(r.w, "table\t%s\t%s\tdelta\tstatus\n", r.rows1Label, r.rows2Label)
+	return err
+}
+
+func (r *CountReport) Write(tc *TableCount) error {
+	status := "OK"
+	if !tc.Match() {
+		status = "MISMATCH"
+	}
+	_, err := fmt.Fprintf(r.w, "%s\t%s\t%s\t%+d\t%s\n", tc.Table, countString(tc.Count1, tc.Exists1), countString(tc.Count2, tc.Exists2), tc.Delta(), status)
+	return err
+}
+
+func countString(cnt int64, exists bool) string {
+	if !exists {
+		return "-"
+	}
+	return strconv.FormatInt(cnt, 10)
+}
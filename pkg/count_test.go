@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/spankeys/testutils"
+)
+
+func TestCountReport(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := NewCountReport(&buf, "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []*TableCount{
+		{Table: "Albums", Count1: 3, Count2: 3, Exists1: true, Exists2: true},
+		{Table: "Singers", Count1: 3, Count2: 1, Exists1: true, Exists2: true},
+		{Table: "Songs", Count1: 2, Exists1: true},
+		{Table: "Venues", Count2: 0, Exists2: true},
+	} {
+		if err := r.Write(tc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, "table\tserver1\tserver2\tdelta\tstatus\n"+
+		"Albums\t3\t3\t+0\tOK\n"+
+		"Singers\t3\t1\t-2\tMISMATCH\n"+
+		"Songs\t2\t-\t-2\tMISMATCH\n"+
+		"Venues\t-\t0\t+0\tMISMATCH\n", buf.String())
+}
+
+func TestCountRows(t *testing.T) {
+	ctx := context.Background()
+	c, err := testutils.NewSpannerClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutils.PrepareDatabase(ctx, []string{
+		`CREATE TABLE Singers (
+  SingerID STRING(36) NOT NULL,
+) PRIMARY KEY(SingerID)`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Apply(ctx, []*spanner.Mutation{
+		spanner.Insert("Singers", []string{"SingerID"}, []interface{}{"singerA"}),
+		spanner.Insert("Singers", []string{"SingerID"}, []interface{}{"singerB"}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := NewDataSource(ctx, c, "Singers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := CountRows(ctx, "Singers", ds, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &TableCount{Table: "Singers", Count1: 2, Count2: 2, Exists1: true, Exists2: true}, tc)
+	assert.True(t, tc.Match())
+
+	tc, err = CountRows(ctx, "Singers", ds, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(-2), tc.Delta())
+	assert.False(t, tc.Match())
+}
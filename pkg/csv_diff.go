@@ -0,0 +1,209 @@
+package pkg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CSVNull is the text of NULL values in CSV (and TSV) records
+const CSVNull = `\N`
+
+// CSVDiff writes RowsDiff as CSV (or TSV) records of the fields
+// table, primary_key_1 ... primary_key_N, column, server1, server2 and change.
+// A record is written for each differing column of the updated rows with change "updated",
+// and for each added or deleted row with change "added" or "deleted", an empty column and
+// the row values as a JSON object in the server the row exists on.
+//
+// The primary key values are written as a field per key column, in the order of the primary key columns.
+// N is given as keyColumns, which must be at least the number of the key columns of every table
+// written under one header; the fields after the key columns of a table are empty.
+//
+// Values are written as plain text: STRING as is, BYTES in base64, ARRAY as a JSON array and
+// the other types as in JSON. NULL is written as CSVNull (\N), so it is distinct from the empty string.
+// A column missing on one server is an empty field there, and the record has change "column_added" or
+// "column_deleted" instead of "updated".
+type CSVDiff struct {
+	w          *csv.Writer
+	table      string
+	rows1Label string
+	rows2Label string
+	keyColumns int
+}
+
+func NewCSVDiff(w io.Writer, table, rows1Label, rows2Label string, keyColumns int) (*CSVDiff, error) {
+	if keyColumns < 1 {
+		return nil, fmt.Errorf("keyColumns must be positive")
+	}
+	return &CSVDiff{
+		w:          csv.NewWriter(w),
+		table:      table,
+		rows1Label: rows1Label,
+		rows2Label: rows2Label,
+		keyColumns: keyColumns,
+	}, nil
+}
+
+func NewTSVDiff(w io.Writer, table, rows1Label, rows2Label string, keyColumns int) (*CSVDiff, error) {
+	cd, err := NewCSVDiff(w, table, rows1Label, rows2Label, keyColumns)
+	if err != nil {
+		return nil, err
+	}
+	cd.w.Comma = '\t'
+	return cd, nil
+}
+
+// WriteHeader writes the header record, which should be written once before the tables
+func (cd *CSVDiff) WriteHeader() error {
+	header := []string{"table"}
+	for i := 1; i <= cd.keyColumns; i++ {
+		header = append(header, fmt.Sprintf("primary_key_%d", i))
+	}
+	header = append(header, "column", "server1", "server2", "change")
+	if err := cd.w.Write(header); err != nil {
+		return err
+	}
+	cd.w.Flush()
+	return cd.w.Error()
+}
+
+func (cd *CSVDiff) Write(rd *RowsDiff, changesFor string) error {
+	if changesFor != cd.rows1Label && changesFor != cd.rows2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", cd.rows1Label, cd.rows2Label)
+	}
+	added, deleted := "added", "deleted"
+	if changesFor == cd.rows2Label {
+		added, deleted = deleted, added
+	}
+
+	for _, d := range rd.DiffRows {
+		pk, err := cd.primaryKey(d.Row1)
+		if err != nil {
+			return err
+		}
+		for _, cn := range diffColumns(rd.Columns, d) {
+			v1, ok1 := d.Row1.ColumnValues[cn]
+			v2, ok2 := d.Row2.ColumnValues[cn]
+			var cv1, cv2 string
+			change := "updated"
+			if ok1 {
+				if cv1, err = csvValue(v1); err != nil {
+					return err
+				}
+			} else {
+				change = "column_" + added
+			}
+			if ok2 {
+				if cv2, err = csvValue(v2); err != nil {
+					return err
+				}
+			} else {
+				change = "column_" + deleted
+			}
+			if err := cd.w.Write(cd.record(pk, cn, cv1, cv2, change)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, row := range rd.Rows2Only {
+		if err := cd.writeRow(row, false, added); err != nil {
+			return err
+		}
+	}
+	for _, row := range rd.Rows1Only {
+		if err := cd.writeRow(row, true, deleted); err != nil {
+			return err
+		}
+	}
+	cd.w.Flush()
+	return cd.w.Error()
+}
+
+// WriteTableOnlyOn writes a record with change "table_added" or "table_deleted" for the table existing only on the database labeled onlyOn
+func (cd *CSVDiff) WriteTableOnlyOn(onlyOn, changesFor string) error {
+	if changesFor != cd.rows1Label && changesFor != cd.rows2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", cd.rows1Label, cd.rows2Label)
+	}
+	if onlyOn != cd.rows1Label && onlyOn != cd.rows2Label {
+		return fmt.Errorf("onlyOn must be '%s' or '%s'", cd.rows1Label, cd.rows2Label)
+	}
+	if err := cd.w.Write(cd.record(nil, "", "", "", "table_"+tableChange(onlyOn, changesFor))); err != nil {
+		return err
+	}
+	cd.w.Flush()
+	return cd.w.Error()
+}
+
+func (cd *CSVDiff) writeRow(row *Row, onRows1 bool, change string) error {
+	pk, err := cd.primaryKey(row)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(jsonScalarValues(row))
+	if err != nil {
+		return err
+	}
+	if onRows1 {
+		return cd.w.Write(cd.record(pk, "", string(b), "", change))
+	}
+	return cd.w.Write(cd.record(pk, "", "", string(b), change))
+}
+
+// record returns the fields of a record, with the primary key fields padded to keyColumns
+func (cd *CSVDiff) record(pk []string, column, v1, v2, change string) []string {
+	record := append([]string{cd.table}, pk...)
+	for i := len(pk); i < cd.keyColumns; i++ {
+		record = append(record, "")
+	}
+	return append(record, column, v1, v2, change)
+}
+
+// primaryKey returns the text of the key values in the order of the primary key columns
+func (cd *CSVDiff) primaryKey(row *Row) ([]string, error) {
+	if len(row.PKCols) > cd.keyColumns {
+		return nil, fmt.Errorf("table %s has %d primary key columns, more than keyColumns %d", cd.table, len(row.PKCols), cd.keyColumns)
+	}
+	var pk []string
+	for _, pkcn := range row.PKCols {
+		v, err := csvValue(row.ColumnValues[pkcn])
+		if err != nil {
+			return nil, err
+		}
+		pk = append(pk, v)
+	}
+	return pk, nil
+}
+
+// diffColumns returns the non-key columns of the row diff in the order of tableCols
+func diffColumns(tableCols []string, d *RowDiff) []string {
+	isPK := make(map[string]bool)
+	for _, pkcn := range d.Row1.PKCols {
+		isPK[pkcn] = true
+	}
+	values := make(map[string]ColumnValue)
+	for _, row := range []*Row{d.Row1, d.Row2} {
+		for cn, cv := range row.ColumnValues {
+			if !isPK[cn] {
+				values[cn] = cv
+			}
+		}
+	}
+	return orderedColumns(tableCols, values)
+}
+
+func jsonScalarValues(row *Row) map[string]interface{} {
+	values := make(map[string]interface{})
+	for cn, cv := range row.ColumnValues {
+		values[cn] = NewJSONValue(cv).Value
+	}
+	return values
+}
+
+// csvValue returns the plain text of the value, or CSVNull for NULL
+func csvValue(v ColumnValue) (string, error) {
+	if NewJSONValue(v).Value == nil {
+		return CSVNull, nil
+	}
+	return textValue(v)
+}
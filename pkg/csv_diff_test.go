@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVDiff(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{
+		Rows1Only: []*Row{{pks, map[string]ColumnValue{"id": int64(1), "data": []byte("a")}}},
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": int64(2), "tags": []string{"x", "y"}}}},
+		DiffRows: []*RowDiff{{
+			[]interface{}{int64(3)},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "line1\nline2", "age": nil, "email": ""}},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "a,b", "age": int64(20), "email": spanner.NullString{}}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	cd, err := NewCSVDiff(&buf, "Singers", "server1", "server2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.Write(rd, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `table,primary_key_1,column,server1,server2,change
+Singers,3,age,\N,20,updated
+Singers,3,email,,\N,updated
+Singers,3,name,"line1
+line2","a,b",updated
+Singers,2,,,"{""id"":""2"",""tags"":[""x"",""y""]}",added
+Singers,1,,"{""data"":""YQ=="",""id"":""1""}",,deleted
+`, buf.String())
+
+	buf.Reset()
+	cd, err = NewTSVDiff(&buf, "Singers", "server1", "server2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.Write(&RowsDiff{Rows1Only: rd.Rows1Only}, "server2"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Singers\t1\t\t\"{\"\"data\"\":\"\"YQ==\"\",\"\"id\"\":\"\"1\"\"}\"\t\tadded\n", buf.String())
+}
+
+func TestCSVDiff_WriteTableOnlyOn(t *testing.T) {
+	var buf bytes.Buffer
+	cd, err := NewCSVDiff(&buf, "Singers", "server1", "server2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.WriteTableOnlyOn("server1", "server1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Singers,,,,,table_deleted\n", buf.String())
+}
+
+func TestCSVDiff_KeyColumns(t *testing.T) {
+	pks := []string{"SingerId", "AlbumId"}
+	rd := &RowsDiff{
+		DiffRows: []*RowDiff{{
+			[]interface{}{int64(1), "a"},
+			&Row{pks, map[string]ColumnValue{"SingerId": int64(1), "AlbumId": "a", "title": "x"}},
+			&Row{pks, map[string]ColumnValue{"SingerId": int64(1), "AlbumId": "a", "title": "y", "rating": nil}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	cd, err := NewCSVDiff(&buf, "Albums", "server1", "server2", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.Write(rd, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `table,primary_key_1,primary_key_2,primary_key_3,column,server1,server2,change
+Albums,1,a,,rating,,\N,column_added
+Albums,1,a,,title,x,y,updated
+`, buf.String())
+
+	cd, err = NewCSVDiff(&buf, "Albums", "server1", "server2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.Write(rd, "server1"); err == nil {
+		t.Fatal("keyColumns less than the primary key columns must be an error")
+	}
+}
@@ -2,6 +2,9 @@ package pkg
 
 import (
 	"context"
+	"fmt"
+	"strings"
+
 	"github.com/castaneai/spankeys"
 
 	"cloud.google.com/go/spanner"
@@ -11,27 +14,79 @@ type DataSource struct {
 	client     *spanner.Client
 	table      string
 	pkColNames []string
+	keyOrder   KeyOrder
+	tb         spanner.TimestampBound
+	tx         *spanner.ReadOnlyTransaction
+}
+
+type DataSourceOption func(s *DataSource)
+
+// WithTimestampBound makes DataSource read rows at the timestamp bound (e.g. spanner.ReadTimestamp) instead of strong reads
+func WithTimestampBound(tb spanner.TimestampBound) DataSourceOption {
+	return func(s *DataSource) {
+		s.tb = tb
+	}
+}
+
+// WithReadOnlyTransaction makes DataSource read rows in the transaction.
+// Sharing a transaction among DataSources of the tables in a database reads all the tables at the same timestamp.
+func WithReadOnlyTransaction(tx *spanner.ReadOnlyTransaction) DataSourceOption {
+	return func(s *DataSource) {
+		s.tx = tx
+	}
 }
 
-func NewDataSource(ctx context.Context, client *spanner.Client, table string) (*DataSource, error) {
-	pkCols, err := spankeys.GetPrimaryKeyColumns(ctx, client, table)
+func NewDataSource(ctx context.Context, client *spanner.Client, table string, opts ...DataSourceOption) (*DataSource, error) {
+	pkNames, keyOrder, err := primaryKeyColumns(ctx, client, table)
 	if err != nil {
 		return nil, err
 	}
-	var pkNames []string
-	for _, col := range pkCols {
-		pkNames = append(pkNames, col.Name)
-	}
-	return &DataSource{
+	s := &DataSource{
 		client:     client,
 		table:      table,
 		pkColNames: pkNames,
-	}, nil
+		keyOrder:   keyOrder,
+		tb:         spanner.StrongRead(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// primaryKeyColumns returns the names and the order of the primary key columns
+func primaryKeyColumns(ctx context.Context, client *spanner.Client, table string) ([]string, KeyOrder, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT COLUMN_NAME, COLUMN_ORDERING FROM INFORMATION_SCHEMA.INDEX_COLUMNS
+WHERE TABLE_CATALOG = '' AND TABLE_SCHEMA = '' AND TABLE_NAME = @table AND INDEX_TYPE = 'PRIMARY_KEY'
+ORDER BY ORDINAL_POSITION`,
+		Params: map[string]interface{}{"table": table},
+	}
+	var names []string
+	var order KeyOrder
+	if err := client.Single().Query(ctx, stmt).Do(func(r *spanner.Row) error {
+		var name string
+		var ordering spanner.NullString
+		if err := r.Columns(&name, &ordering); err != nil {
+			return err
+		}
+		names = append(names, name)
+		order = append(order, ordering.StringVal == "DESC")
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	return names, order, nil
+}
+
+// KeyOrder returns the order of the primary key, in which RowIterator returns rows
+func (s *DataSource) KeyOrder() KeyOrder {
+	return s.keyOrder
 }
 
 func (s *DataSource) Rows(ctx context.Context, stmt spanner.Statement) ([]*Row, error) {
 	var rows []*Row
-	if err := s.client.Single().Query(ctx, stmt).Do(func(r *spanner.Row) error {
+	if err := s.query(ctx, stmt).Do(func(r *spanner.Row) error {
 		row, err := makeRow(r, s.pkColNames)
 		if err != nil {
 			return err
@@ -44,6 +99,68 @@ func (s *DataSource) Rows(ctx context.Context, stmt spanner.Statement) ([]*Row,
 	return rows, nil
 }
 
+// Count returns the number of rows in the table
+func (s *DataSource) Count(ctx context.Context) (int64, error) {
+	var cnt int64
+	stmt := spanner.NewStatement(fmt.Sprintf("SELECT COUNT(*) FROM `%s`", s.table))
+	if err := s.query(ctx, stmt).Do(func(r *spanner.Row) error {
+		return r.Columns(&cnt)
+	}); err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
+func (s *DataSource) query(ctx context.Context, stmt spanner.Statement) *spanner.RowIterator {
+	if s.tx != nil {
+		return s.tx.Query(ctx, stmt)
+	}
+	return s.client.Single().WithTimestampBound(s.tb).Query(ctx, stmt)
+}
+
+// RowIterator returns the rows of the table ordered by the primary key in KeyOrder.
+// Rows are fetched from Spanner as they are consumed, so memory usage does not depend on the size of the table.
+func (s *DataSource) RowIterator(ctx context.Context) RowIterator {
+	stmt := spanner.NewStatement(fmt.Sprintf("SELECT * FROM `%s` ORDER BY %s", s.table, s.orderByPrimaryKey()))
+	return s.rowIterator(ctx, stmt)
+}
+
+func (s *DataSource) orderByPrimaryKey() string {
+	var orders []string
+	for i, pkcn := range s.pkColNames {
+		dir := "ASC"
+		if i < len(s.keyOrder) && s.keyOrder[i] {
+			dir = "DESC"
+		}
+		orders = append(orders, fmt.Sprintf("`%s` %s", pkcn, dir))
+	}
+	return strings.Join(orders, ",")
+}
+
+func (s *DataSource) rowIterator(ctx context.Context, stmt spanner.Statement) RowIterator {
+	return &spannerRowIterator{
+		iter:   s.query(ctx, stmt),
+		pkCols: s.pkColNames,
+	}
+}
+
+type spannerRowIterator struct {
+	iter   *spanner.RowIterator
+	pkCols []string
+}
+
+func (it *spannerRowIterator) Next() (*Row, error) {
+	r, err := it.iter.Next()
+	if err != nil {
+		return nil, err
+	}
+	return makeRow(r, it.pkCols)
+}
+
+func (it *spannerRowIterator) Stop() {
+	it.iter.Stop()
+}
+
 func makeRow(r *spanner.Row, pkCols []string) (*Row, error) {
 	row := &Row{
 		ColumnValues: make(map[string]ColumnValue),
@@ -62,3 +62,46 @@ func TestDataSource_Rows(t *testing.T) {
 		assert.Equal(t, "singerB-name", rows[1].ColumnValues["FirstName"])
 	}
 }
+
+func TestDataSource_RowIterator_DescKey(t *testing.T) {
+	ctx := context.Background()
+	c, err := testutils.NewSpannerClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutils.PrepareDatabase(ctx, []string{
+		`CREATE TABLE Events (
+  Day STRING(10) NOT NULL,
+  Seq INT64 NOT NULL,
+  Name STRING(1024),
+) PRIMARY KEY(Day, Seq DESC)`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cols := []string{"Day", "Seq", "Name"}
+	if _, err := c.Apply(ctx, []*spanner.Mutation{
+		spanner.Insert("Events", cols, []interface{}{"2020-01-01", int64(1), "a"}),
+		spanner.Insert("Events", cols, []interface{}{"2020-01-01", int64(2), "b"}),
+		spanner.Insert("Events", cols, []interface{}{"2020-01-01", int64(3), "c"}),
+		spanner.Insert("Events", cols, []interface{}{"2020-01-02", int64(1), "d"}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := NewDataSource(ctx, c, "Events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, KeyOrder{false, true}, ds.KeyOrder())
+
+	// the rows are read in DESC order, which must not be rejected as unordered
+	rd := &RowsDiff{}
+	if err := CompareRowIteratorsInOrder(ds.RowIterator(ctx), &sliceRowIterator{}, ds.KeyOrder(), &DefaultRowComparator{}, rd); err != nil {
+		t.Fatal(err)
+	}
+	var seqs []int64
+	for _, row := range rd.Rows1Only {
+		_, seq := normalizeValue(row.ColumnValues["Seq"])
+		seqs = append(seqs, seq.(int64))
+	}
+	assert.Equal(t, []int64{3, 2, 1, 1}, seqs)
+}
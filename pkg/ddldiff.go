@@ -0,0 +1,280 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DDLDiff generates DDL statements to make the schema of one database the same as the other
+type DDLDiff struct {
+	sd           *SchemaDiff
+	schema1Label string
+	schema2Label string
+}
+
+func NewDDLDiff(sd *SchemaDiff, schema1Label, schema2Label string) (*DDLDiff, error) {
+	return &DDLDiff{
+		sd:           sd,
+		schema1Label: schema1Label,
+		schema2Label: schema2Label,
+	}, nil
+}
+
+// DDL returns the statements to apply to changesFor, in the order they should be executed.
+// Changes that Spanner cannot apply by DDL are not included; see UnsupportedChanges.
+func (dd *DDLDiff) DDL(changesFor string) ([]string, error) {
+	if err := dd.validateChangesFor(changesFor); err != nil {
+		return nil, err
+	}
+	ddls, _ := dd.plan(changesFor == dd.schema2Label)
+	return ddls, nil
+}
+
+// UnsupportedChanges describes the differences that cannot be reconciled by DDL,
+// such as changes of primary keys which require recreating the table.
+func (dd *DDLDiff) UnsupportedChanges(changesFor string) ([]string, error) {
+	if err := dd.validateChangesFor(changesFor); err != nil {
+		return nil, err
+	}
+	_, unsupported := dd.plan(changesFor == dd.schema2Label)
+	return unsupported, nil
+}
+
+func (dd *DDLDiff) validateChangesFor(changesFor string) error {
+	if changesFor != dd.schema1Label && changesFor != dd.schema2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", dd.schema1Label, dd.schema2Label)
+	}
+	return nil
+}
+
+// plan generates DDL statements in the following order so that every statement is valid when executed:
+// drop foreign keys, drop indexes, drop tables (children first), alter tables,
+// create tables (parents first), create indexes and add foreign keys.
+func (dd *DDLDiff) plan(reversed bool) ([]string, []string) {
+	tablesCreated, tablesDropped := dd.sd.Tables2Only, dd.sd.Tables1Only
+	if reversed {
+		tablesCreated, tablesDropped = tablesDropped, tablesCreated
+	}
+
+	var dropFKs, dropIndexes, dropTables, alters, createTables, createIndexes, addFKs, unsupported []string
+
+	for _, t := range sortByInterleaveDepth(tablesDropped, true) {
+		for _, fk := range t.ForeignKeys {
+			dropFKs = append(dropFKs, dropForeignKeyDDL(fk))
+		}
+		for _, idx := range t.Indexes {
+			dropIndexes = append(dropIndexes, dropIndexDDL(idx))
+		}
+		dropTables = append(dropTables, fmt.Sprintf("DROP TABLE `%s`", t.Name))
+	}
+
+	for _, td := range dd.sd.DiffTables {
+		from, to := td.Table1, td.Table2
+		colsAdded, colsDropped := td.Columns2Only, td.Columns1Only
+		idxesAdded, idxesDropped := td.Indexes2Only, td.Indexes1Only
+		fksAdded, fksDropped := td.ForeignKeys2Only, td.ForeignKeys1Only
+		if reversed {
+			from, to = to, from
+			colsAdded, colsDropped = colsDropped, colsAdded
+			idxesAdded, idxesDropped = idxesDropped, idxesAdded
+			fksAdded, fksDropped = fksDropped, fksAdded
+		}
+
+		if td.PrimaryKeyDiffers {
+			unsupported = append(unsupported, fmt.Sprintf("table `%s`: changing the primary key from (%s) to (%s) requires recreating the table",
+				td.Name, keyPartsDefinition(from.PrimaryKey), keyPartsDefinition(to.PrimaryKey)))
+		}
+		if from.ParentTable != to.ParentTable {
+			unsupported = append(unsupported, fmt.Sprintf("table `%s`: changing the parent table from `%s` to `%s` requires recreating the table",
+				td.Name, from.ParentTable, to.ParentTable))
+		} else if from.OnDeleteAction != to.OnDeleteAction {
+			alters = append(alters, fmt.Sprintf("ALTER TABLE `%s` SET ON DELETE %s", td.Name, to.OnDeleteAction))
+		}
+
+		for _, fk := range fksDropped {
+			dropFKs = append(dropFKs, dropForeignKeyDDL(fk))
+		}
+		for _, fd := range td.DiffForeignKeys {
+			fkFrom, fkTo := fd.ForeignKey1, fd.ForeignKey2
+			if reversed {
+				fkFrom, fkTo = fkTo, fkFrom
+			}
+			dropFKs = append(dropFKs, dropForeignKeyDDL(fkFrom))
+			addFKs = append(addFKs, addForeignKeyDDL(fkTo))
+		}
+		for _, fk := range fksAdded {
+			addFKs = append(addFKs, addForeignKeyDDL(fk))
+		}
+
+		for _, idx := range idxesDropped {
+			dropIndexes = append(dropIndexes, dropIndexDDL(idx))
+		}
+		for _, id := range td.DiffIndexes {
+			idxFrom, idxTo := id.Index1, id.Index2
+			if reversed {
+				idxFrom, idxTo = idxTo, idxFrom
+			}
+			dropIndexes = append(dropIndexes, dropIndexDDL(idxFrom))
+			createIndexes = append(createIndexes, indexDefinition(idxTo))
+		}
+		for _, idx := range idxesAdded {
+			createIndexes = append(createIndexes, indexDefinition(idx))
+		}
+
+		for _, col := range colsDropped {
+			alters = append(alters, fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", td.Name, col.Name))
+		}
+		for _, cd := range td.DiffColumns {
+			colFrom, colTo := cd.Column1, cd.Column2
+			if reversed {
+				colFrom, colTo = colTo, colFrom
+			}
+			ddls, reason := alterColumnDDL(to, colFrom, colTo)
+			if reason != "" {
+				unsupported = append(unsupported, fmt.Sprintf("column `%s`.`%s`: %s", td.Name, colTo.Name, reason))
+				continue
+			}
+			alters = append(alters, ddls...)
+		}
+		for _, col := range colsAdded {
+			if !col.IsNullable {
+				unsupported = append(unsupported, fmt.Sprintf("column `%s`.`%s`: adding a NOT NULL column to an existing table is not supported; add it as nullable, backfill and then alter it to NOT NULL", td.Name, col.Name))
+				continue
+			}
+			alters = append(alters, fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN %s", td.Name, columnDefinition(col)))
+		}
+	}
+
+	for _, t := range sortByInterleaveDepth(tablesCreated, false) {
+		createTables = append(createTables, createTableDDL(t))
+		for _, idx := range t.Indexes {
+			createIndexes = append(createIndexes, indexDefinition(idx))
+		}
+		for _, fk := range t.ForeignKeys {
+			addFKs = append(addFKs, addForeignKeyDDL(fk))
+		}
+	}
+
+	var ddls []string
+	for _, stmts := range [][]string{dropFKs, dropIndexes, dropTables, alters, createTables, createIndexes, addFKs} {
+		ddls = append(ddls, stmts...)
+	}
+	return ddls, unsupported
+}
+
+// alterColumnDDL returns statements to change the column definition from c1 to c2,
+// or the reason why it cannot be changed.
+func alterColumnDDL(t *TableSchema, c1, c2 *ColumnSchema) ([]string, string) {
+	var ddls []string
+	if c1.SpannerType != c2.SpannerType || c1.IsNullable != c2.IsNullable {
+		for _, kp := range t.PrimaryKey {
+			if kp.Column == c2.Name {
+				return nil, "a key column cannot be altered"
+			}
+		}
+		if !convertibleSpannerTypes(c1.SpannerType, c2.SpannerType) {
+			return nil, fmt.Sprintf("changing the type from %s to %s is not supported", c1.SpannerType, c2.SpannerType)
+		}
+		def := fmt.Sprintf("ALTER TABLE `%s` ALTER COLUMN `%s` %s", t.Name, c2.Name, c2.SpannerType)
+		if !c2.IsNullable {
+			def += " NOT NULL"
+		}
+		ddls = append(ddls, def)
+	}
+	if !reflect.DeepEqual(c1.Options, c2.Options) && (len(c1.Options) > 0 || len(c2.Options) > 0) {
+		var names []string
+		for name := range c1.Options {
+			if _, ok := c2.Options[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		for name := range c2.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var opts []string
+		for _, name := range names {
+			value, ok := c2.Options[name]
+			if !ok {
+				value = "null"
+			}
+			opts = append(opts, fmt.Sprintf("%s = %s", name, strings.ToLower(value)))
+		}
+		ddls = append(ddls, fmt.Sprintf("ALTER TABLE `%s` ALTER COLUMN `%s` SET OPTIONS (%s)", t.Name, c2.Name, strings.Join(opts, ", ")))
+	}
+	return ddls, ""
+}
+
+// convertibleSpannerTypes reports whether a column of type t1 can be altered to type t2.
+// Spanner only supports changing the length and converting between STRING and BYTES.
+func convertibleSpannerTypes(t1, t2 string) bool {
+	bt1, bt2 := baseSpannerType(t1), baseSpannerType(t2)
+	if bt1 == bt2 {
+		return true
+	}
+	convertible := map[string]string{
+		"STRING":        "BYTES",
+		"BYTES":         "STRING",
+		"ARRAY<STRING>": "ARRAY<BYTES>",
+		"ARRAY<BYTES>":  "ARRAY<STRING>",
+	}
+	return convertible[bt1] == bt2
+}
+
+// baseSpannerType removes the length from the type, e.g. ARRAY<STRING(10)> -> ARRAY<STRING>
+func baseSpannerType(t string) string {
+	if i := strings.Index(t, "("); i >= 0 {
+		if j := strings.Index(t[i:], ")"); j >= 0 {
+			return t[:i] + t[i+j+1:]
+		}
+	}
+	return t
+}
+
+// sortByInterleaveDepth sorts tables so that parent tables come before their interleaved children.
+// If childrenFirst is true, children come first instead.
+func sortByInterleaveDepth(tables []*TableSchema, childrenFirst bool) []*TableSchema {
+	byName := make(map[string]*TableSchema, len(tables))
+	for _, t := range tables {
+		byName[t.Name] = t
+	}
+	depth := func(t *TableSchema) int {
+		d := 0
+		for p, ok := byName[t.ParentTable]; ok && d < len(tables); p, ok = byName[p.ParentTable] {
+			d++
+		}
+		return d
+	}
+
+	sorted := make([]*TableSchema, len(tables))
+	copy(sorted, tables)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if childrenFirst {
+			return depth(sorted[i]) > depth(sorted[j])
+		}
+		return depth(sorted[i]) < depth(sorted[j])
+	})
+	return sorted
+}
+
+func createTableDDL(t *TableSchema) string {
+	var defs []string
+	for _, col := range t.Columns {
+		defs = append(defs, columnDefinition(col))
+	}
+	return fmt.Sprintf("CREATE TABLE `%s` (%s) %s", t.Name, strings.Join(defs, ", "), primaryKeyDefinition(t))
+}
+
+func dropIndexDDL(idx *IndexSchema) string {
+	return fmt.Sprintf("DROP INDEX `%s`", idx.Name)
+}
+
+func addForeignKeyDDL(fk *ForeignKeySchema) string {
+	return fmt.Sprintf("ALTER TABLE `%s` ADD %s", fk.Table, foreignKeyDefinition(fk))
+}
+
+func dropForeignKeyDDL(fk *ForeignKeySchema) string {
+	return fmt.Sprintf("ALTER TABLE `%s` DROP CONSTRAINT `%s`", fk.Table, fk.Name)
+}
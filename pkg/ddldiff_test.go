@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDDLDiff_CreateAndDropTables(t *testing.T) {
+	s1 := &Schema{}
+	s2 := singersSchema()
+	// children are listed before their parents to test the ordering
+	s2.Tables = []*TableSchema{s2.Tables[1], s2.Tables[0]}
+
+	dd, err := NewDDLDiff(CompareSchemas(s1, s2), "schema1", "schema2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ddls, err := dd.DDL("schema1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"CREATE TABLE `Singers` (`SingerID` STRING(36) NOT NULL, `FirstName` STRING(1024), `UpdatedAt` TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true)) PRIMARY KEY (`SingerID`)",
+		"CREATE TABLE `Albums` (`SingerID` STRING(36) NOT NULL, `AlbumID` INT64 NOT NULL) PRIMARY KEY (`SingerID`, `AlbumID`), INTERLEAVE IN PARENT `Singers` ON DELETE CASCADE",
+		"CREATE INDEX `SingersByFirstName` ON `Singers` (`FirstName`)",
+	}, ddls)
+
+	ddls, err = dd.DDL("schema2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"DROP INDEX `SingersByFirstName`",
+		"DROP TABLE `Albums`",
+		"DROP TABLE `Singers`",
+	}, ddls)
+}
+
+func TestDDLDiff_AlterTables(t *testing.T) {
+	s1 := singersSchema()
+	s2 := singersSchema()
+	singers2 := s2.Table("Singers")
+	singers2.Columns[1] = &ColumnSchema{Name: "FirstName", OrdinalPosition: 2, SpannerType: "STRING(MAX)", IsNullable: true}
+	singers2.Columns[2] = &ColumnSchema{Name: "UpdatedAt", OrdinalPosition: 3, SpannerType: "TIMESTAMP"}
+	singers2.Columns = append(singers2.Columns, &ColumnSchema{Name: "LastName", OrdinalPosition: 4, SpannerType: "STRING(1024)", IsNullable: true})
+	singers2.Indexes = []*IndexSchema{{Name: "SingersByLastName", Table: "Singers", Columns: []*KeyPart{{Column: "LastName"}}, StoringColumns: []string{"FirstName"}}}
+	albums2 := s2.Table("Albums")
+	albums2.OnDeleteAction = "NO ACTION"
+
+	dd, err := NewDDLDiff(CompareSchemas(s1, s2), "schema1", "schema2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ddls, err := dd.DDL("schema1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"DROP INDEX `SingersByFirstName`",
+		"ALTER TABLE `Singers` ALTER COLUMN `FirstName` STRING(MAX)",
+		"ALTER TABLE `Singers` ALTER COLUMN `UpdatedAt` SET OPTIONS (allow_commit_timestamp = null)",
+		"ALTER TABLE `Singers` ADD COLUMN `LastName` STRING(1024)",
+		"ALTER TABLE `Albums` SET ON DELETE NO ACTION",
+		"CREATE INDEX `SingersByLastName` ON `Singers` (`LastName`) STORING (`FirstName`)",
+	}, ddls)
+	unsupported, err := dd.UnsupportedChanges("schema1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(unsupported))
+}
+
+func TestDDLDiff_UnsupportedChanges(t *testing.T) {
+	s1 := singersSchema()
+	s2 := singersSchema()
+	singers2 := s2.Table("Singers")
+	singers2.Columns[1] = &ColumnSchema{Name: "FirstName", OrdinalPosition: 2, SpannerType: "INT64", IsNullable: true}
+	singers2.Columns = append(singers2.Columns, &ColumnSchema{Name: "LastName", OrdinalPosition: 4, SpannerType: "STRING(1024)"})
+	albums2 := s2.Table("Albums")
+	albums2.PrimaryKey = []*KeyPart{{Column: "SingerID"}, {Column: "AlbumID", Desc: true}}
+
+	dd, err := NewDDLDiff(CompareSchemas(s1, s2), "schema1", "schema2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ddls, err := dd.DDL("schema1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(ddls))
+	unsupported, err := dd.UnsupportedChanges("schema1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(unsupported))
+}
+
+func TestConvertibleSpannerTypes(t *testing.T) {
+	assert.Equal(t, true, convertibleSpannerTypes("STRING(10)", "STRING(MAX)"))
+	assert.Equal(t, true, convertibleSpannerTypes("STRING(10)", "BYTES(10)"))
+	assert.Equal(t, true, convertibleSpannerTypes("ARRAY<BYTES(10)>", "ARRAY<STRING(MAX)>"))
+	assert.Equal(t, false, convertibleSpannerTypes("STRING(10)", "INT64"))
+	assert.Equal(t, false, convertibleSpannerTypes("ARRAY<INT64>", "INT64"))
+}
@@ -1,13 +1,81 @@
 package pkg
 
+import "sort"
+
 // Differences among rows
 // set nil if there is no differences
 type RowsDiff struct {
 	Rows1Only []*Row
 	Rows2Only []*Row
 	DiffRows  []*RowDiff
+	// Columns of the table in order, which the writers follow. Columns not listed are ordered by name.
+	Columns []string
+}
+
+// tableChange returns how the table existing only on onlyOn changes to make changesFor the other: "added" or "deleted"
+func tableChange(onlyOn, changesFor string) string {
+	if onlyOn == changesFor {
+		return "deleted"
+	}
+	return "added"
 }
 
 func (d *RowsDiff) HasDiff() bool {
 	return len(d.Rows1Only) > 0 || len(d.Rows2Only) > 0 || len(d.DiffRows) > 0
 }
+
+// Sort sorts the rows by the primary key in the order
+func (d *RowsDiff) Sort(order KeyOrder) error {
+	var err error
+	less := func(pk1, pk2 PrimaryKey) bool {
+		c, cerr := order.Compare(pk1, pk2)
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+		return c < 0
+	}
+	sort.SliceStable(d.Rows1Only, func(i, j int) bool {
+		return less(d.Rows1Only[i].PrimaryKey(), d.Rows1Only[j].PrimaryKey())
+	})
+	sort.SliceStable(d.Rows2Only, func(i, j int) bool {
+		return less(d.Rows2Only[i].PrimaryKey(), d.Rows2Only[j].PrimaryKey())
+	})
+	sort.SliceStable(d.DiffRows, func(i, j int) bool {
+		return less(d.DiffRows[i].PrimaryKey, d.DiffRows[j].PrimaryKey)
+	})
+	return err
+}
+
+// orderedColumns returns the columns of values in the order of cols, followed by the others ordered by name
+func orderedColumns(cols []string, values map[string]ColumnValue) []string {
+	var ordered, others []string
+	listed := make(map[string]bool)
+	for _, cn := range cols {
+		listed[cn] = true
+		if _, ok := values[cn]; ok {
+			ordered = append(ordered, cn)
+		}
+	}
+	for cn := range values {
+		if !listed[cn] {
+			others = append(others, cn)
+		}
+	}
+	sort.Strings(others)
+	return append(ordered, others...)
+}
+
+func (d *RowsDiff) OnRows1Only(row *Row) error {
+	d.Rows1Only = append(d.Rows1Only, row)
+	return nil
+}
+
+func (d *RowsDiff) OnRows2Only(row *Row) error {
+	d.Rows2Only = append(d.Rows2Only, row)
+	return nil
+}
+
+func (d *RowsDiff) OnDiffRow(rd *RowDiff) error {
+	d.DiffRows = append(d.DiffRows, rd)
+	return nil
+}
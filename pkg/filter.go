@@ -0,0 +1,190 @@
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namePattern matches names by one of the following syntaxes:
+//   - a regular expression enclosed in slashes, e.g. /^User.*$/
+//   - a glob pattern containing *, ? or [, e.g. User*
+//   - otherwise the exact name
+type namePattern struct {
+	exact string
+	glob  string
+	re    *regexp.Regexp
+}
+
+func newNamePattern(s string) (*namePattern, error) {
+	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", s, err)
+		}
+		return &namePattern{re: re}, nil
+	}
+	if strings.ContainsAny(s, "*?[") {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %v", s, err)
+		}
+		return &namePattern{glob: s}, nil
+	}
+	return &namePattern{exact: s}, nil
+}
+
+func (p *namePattern) match(name string) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(name)
+	case p.glob != "":
+		matched, _ := path.Match(p.glob, name)
+		return matched
+	}
+	return p.exact == name
+}
+
+func newNamePatterns(ss []string) ([]*namePattern, error) {
+	var ps []*namePattern
+	for _, s := range ss {
+		p, err := newNamePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func matchAny(ps []*namePattern, name string) bool {
+	for _, p := range ps {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// TableFilter selects tables by names, glob patterns and regular expressions enclosed in slashes.
+// A table is selected if it matches any of includes (or includes is empty) and none of excludes.
+type TableFilter struct {
+	includes []*namePattern
+	excludes []*namePattern
+}
+
+func NewTableFilter(includes, excludes []string) (*TableFilter, error) {
+	ips, err := newNamePatterns(includes)
+	if err != nil {
+		return nil, err
+	}
+	eps, err := newNamePatterns(excludes)
+	if err != nil {
+		return nil, err
+	}
+	return &TableFilter{
+		includes: ips,
+		excludes: eps,
+	}, nil
+}
+
+func (f *TableFilter) Match(table string) bool {
+	if len(f.includes) > 0 && !matchAny(f.includes, table) {
+		return false
+	}
+	return !matchAny(f.excludes, table)
+}
+
+func (f *TableFilter) Filter(tables []string) []string {
+	var filtered []string
+	for _, t := range tables {
+		if f.Match(t) {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+func (f *TableFilter) FilterSchema(s *Schema) *Schema {
+	filtered := &Schema{}
+	for _, t := range s.Tables {
+		if f.Match(t.Name) {
+			filtered.Tables = append(filtered.Tables, t)
+		}
+	}
+	return filtered
+}
+
+// ColumnFilter selects columns of tables by patterns in the form of Column or Table.Column.
+// Both parts accept the same syntax as TableFilter, e.g. *.UpdatedAt or /^Singer/.Name.
+// A pattern without the table part matches the columns of all tables.
+type ColumnFilter struct {
+	patterns []*columnPattern
+}
+
+type columnPattern struct {
+	// nil matches all tables
+	table  *namePattern
+	column *namePattern
+}
+
+func NewColumnFilter(patterns []string) (*ColumnFilter, error) {
+	f := &ColumnFilter{}
+	for _, s := range patterns {
+		ts, cs := splitColumnPattern(s)
+		cp := &columnPattern{}
+		if ts != "" {
+			tp, err := newNamePattern(ts)
+			if err != nil {
+				return nil, err
+			}
+			cp.table = tp
+		}
+		colp, err := newNamePattern(cs)
+		if err != nil {
+			return nil, err
+		}
+		cp.column = colp
+		f.patterns = append(f.patterns, cp)
+	}
+	return f, nil
+}
+
+// splitColumnPattern splits a pattern into the table part and the column part.
+// The table part is empty if the pattern has no qualifier.
+func splitColumnPattern(s string) (string, string) {
+	if strings.HasPrefix(s, "/") {
+		// the table part is a regular expression like /^Singer/.Name
+		if i := strings.Index(s[1:], "/."); i >= 0 && i+3 < len(s) {
+			return s[:i+2], s[i+3:]
+		}
+		return "", s
+	}
+	if i := strings.Index(s, "."); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+func (f *ColumnFilter) Match(table, column string) bool {
+	for _, p := range f.patterns {
+		if p.table != nil && !p.table.match(table) {
+			continue
+		}
+		if p.column.match(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the columns of the table matching any of the patterns
+func (f *ColumnFilter) Filter(table string, columns []string) []string {
+	var filtered []string
+	for _, cn := range columns {
+		if f.Match(table, cn) {
+			filtered = append(filtered, cn)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableFilter(t *testing.T) {
+	tables := []string{"Singers", "SingerLogs", "Albums", "AlbumsBackup", "Songs"}
+
+	{
+		f, err := NewTableFilter(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tables, f.Filter(tables))
+	}
+
+	{
+		f, err := NewTableFilter([]string{"Singer*", "Albums"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"Singers", "SingerLogs", "Albums"}, f.Filter(tables))
+	}
+
+	{
+		f, err := NewTableFilter(nil, []string{"/(Logs|Backup)$/", "Songs"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"Singers", "Albums"}, f.Filter(tables))
+	}
+
+	{
+		f, err := NewTableFilter([]string{"/^S/"}, []string{"*Logs"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"Singers", "Songs"}, f.Filter(tables))
+	}
+}
+
+func TestTableFilter_InvalidPattern(t *testing.T) {
+	_, err := NewTableFilter([]string{"/(/"}, nil)
+	assert.Error(t, err)
+	_, err = NewTableFilter(nil, []string{"[a-"})
+	assert.Error(t, err)
+}
+
+func TestColumnFilter(t *testing.T) {
+	f, err := NewColumnFilter([]string{"CreatedAt", "*.UpdatedAt", "Singers.Memo", "/^Album/./Count$/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"CreatedAt", "UpdatedAt", "Memo"}, f.Filter("Singers", []string{"SingerID", "CreatedAt", "UpdatedAt", "Memo", "PlayCount"}))
+	assert.Equal(t, []string{"CreatedAt", "UpdatedAt", "PlayCount"}, f.Filter("Albums", []string{"AlbumID", "CreatedAt", "UpdatedAt", "Memo", "PlayCount"}))
+	assert.Equal(t, true, f.Match("Songs", "UpdatedAt"))
+	assert.Equal(t, false, f.Match("Songs", "Memo"))
+}
+
+func TestSplitColumnPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		table   string
+		column  string
+	}{
+		{"Column", "", "Column"},
+		{"Table.Column", "Table", "Column"},
+		{"*.Column", "*", "Column"},
+		{"/^Col.*$/", "", "/^Col.*$/"},
+		{"/^Tab.e$/./^Col/", "/^Tab.e$/", "/^Col/"},
+	}
+	for _, c := range cases {
+		table, column := splitColumnPattern(c.pattern)
+		assert.Equal(t, c.table, table, c.pattern)
+		assert.Equal(t, c.column, column, c.pattern)
+	}
+}
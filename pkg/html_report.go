@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"sync"
+)
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 0.5em 0 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; font-family: monospace; white-space: pre-wrap; }
+th { background: #f0f0f0; }
+summary { cursor: pointer; font-size: 1.2em; margin: 0.5em 0; }
+.added { background: #e6ffec; }
+.deleted { background: #ffebe9; }
+.null { color: #999; font-style: italic; }
+.ok { color: #1a7f37; }
+.ng { color: #cf222e; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Changes for <b>{{.Before}}</b> to be <b>{{.After}}</b></p>
+{{if .ReadTimestamps}}<table>
+<tr><th>Server</th><th>Read timestamp</th></tr>
+{{range .ReadTimestamps}}<tr><td>{{.Label}}</td><td>{{.Timestamp}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Summary</h2>
+<table>
+<tr><th>Table</th><th>Added</th><th>Deleted</th><th>Updated</th><th>Status</th></tr>
+{{range .Tables}}<tr><td><a href="#table-{{.Name}}">{{.Name}}</a></td><td>{{len .Added.Rows}}</td><td>{{len .Deleted.Rows}}</td><td>{{.UpdatedRows}}</td>{{if .TableChange}}<td class="ng">TABLE {{.TableChange}}</td>{{else if .HasDiff}}<td class="ng">DIFF</td>{{else}}<td class="ok">OK</td>{{end}}</tr>
+{{end}}</table>
+{{range .Tables}}
+<details id="table-{{.Name}}"{{if .HasDiff}} open{{end}}>
+<summary>{{.Name}}</summary>
+{{if .TableChange}}<p>The table is {{.TableChange}}, whose rows are not compared</p>
+{{end}}{{if .Updated}}<h3>{{.UpdatedRows}} rows updated</h3>
+<table>
+<tr>{{range .PKCols}}<th>{{.}}</th>{{end}}<th>Column</th><th>{{$.Before}}</th><th>{{$.After}}</th></tr>
+{{range .Updated}}<tr>{{range .PrimaryKey}}<td>{{.}}</td>{{end}}<th>{{.Column}}</th>{{template "cell" .Before}}{{template "cell" .After}}</tr>
+{{end}}</table>
+{{end}}{{if .Added.Rows}}<h3>{{len .Added.Rows}} rows added</h3>
+{{template "rows" .Added}}
+{{end}}{{if .Deleted.Rows}}<h3>{{len .Deleted.Rows}} rows deleted</h3>
+{{template "rows" .Deleted}}
+{{end}}{{if not .HasDiff}}<p>No diff found</p>
+{{end}}</details>
+{{end}}</body>
+</html>
+{{define "cell"}}<td class="{{.Class}}">{{if .Null}}<span class="null">NULL</span>{{else}}{{.Text}}{{end}}</td>{{end}}
+{{define "rows"}}<table>
+<tr>{{range .Cols}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}{{template "cell" .}}{{end}}</tr>
+{{end}}</table>{{end}}
+`))
+
+type htmlCell struct {
+	Text  string
+	Null  bool
+	Class string
+}
+
+type htmlCellDiff struct {
+	PrimaryKey []string
+	Column     string
+	Before     *htmlCell
+	After      *htmlCell
+}
+
+type htmlRows struct {
+	Cols []string
+	Rows [][]*htmlCell
+}
+
+type htmlTable struct {
+	Name        string
+	PKCols      []string
+	Added       *htmlRows
+	Deleted     *htmlRows
+	Updated     []*htmlCellDiff
+	UpdatedRows int
+	// TableChange is "added" or "deleted" if the table exists on only either database
+	TableChange string
+}
+
+func (t *htmlTable) HasDiff() bool {
+	return len(t.Added.Rows) > 0 || len(t.Deleted.Rows) > 0 || t.UpdatedRows > 0 || t.TableChange != ""
+}
+
+type htmlReadTimestamp struct {
+	Label     string
+	Timestamp string
+}
+
+type htmlReportTable struct {
+	name   string
+	cols   []string
+	rd     *RowsDiff
+	onlyOn string
+}
+
+// HTMLReport accumulates RowsDiff of tables and writes them as a single HTML file
+// with a summary and a collapsible section per table, which can be viewed offline.
+// AddTable can be called concurrently.
+type HTMLReport struct {
+	title      string
+	rows1Label string
+	rows2Label string
+	readTs     []*htmlReadTimestamp
+	mu         sync.Mutex
+	tables     []*htmlReportTable
+}
+
+func NewHTMLReport(title, rows1Label, rows2Label string) (*HTMLReport, error) {
+	return &HTMLReport{
+		title:      title,
+		rows1Label: rows1Label,
+		rows2Label: rows2Label,
+	}, nil
+}
+
+// SetReadTimestamps sets the timestamps (or timestamp bounds) at which rows1 and rows2 were read, to be shown in the report
+func (r *HTMLReport) SetReadTimestamps(rows1, rows2 string) {
+	r.readTs = []*htmlReadTimestamp{{Label: r.rows1Label, Timestamp: rows1}, {Label: r.rows2Label, Timestamp: rows2}}
+}
+
+func (r *HTMLReport) AddTable(table string, cols []string, rd *RowsDiff) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables = append(r.tables, &htmlReportTable{name: table, cols: cols, rd: rd})
+}
+
+// AddTableOnlyOn adds the table existing only on the database labeled onlyOn
+func (r *HTMLReport) AddTableOnlyOn(table, onlyOn string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables = append(r.tables, &htmlReportTable{name: table, rd: &RowsDiff{}, onlyOn: onlyOn})
+}
+
+// Write writes the report with the tables in name order
+func (r *HTMLReport) Write(w io.Writer, changesFor string) error {
+	if changesFor != r.rows1Label && changesFor != r.rows2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", r.rows1Label, r.rows2Label)
+	}
+	before, after := r.rows1Label, r.rows2Label
+	if changesFor == r.rows2Label {
+		before, after = after, before
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tables []*htmlTable
+	for _, t := range r.tables {
+		ht := newHTMLTable(t, changesFor == r.rows2Label)
+		if t.onlyOn != "" {
+			ht.TableChange = tableChange(t.onlyOn, changesFor)
+		}
+		tables = append(tables, ht)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return htmlReportTemplate.Execute(w, map[string]interface{}{
+		"Title":          r.title,
+		"Before":         before,
+		"After":          after,
+		"ReadTimestamps": r.readTs,
+		"Tables":         tables,
+	})
+}
+
+func newHTMLTable(t *htmlReportTable, reversed bool) *htmlTable {
+	rowsAdded, rowsDeleted := t.rd.Rows2Only, t.rd.Rows1Only
+	if reversed {
+		rowsAdded, rowsDeleted = rowsDeleted, rowsAdded
+	}
+	ht := &htmlTable{
+		Name:        t.name,
+		Added:       newHTMLRows(t.cols, rowsAdded, "added"),
+		Deleted:     newHTMLRows(t.cols, rowsDeleted, "deleted"),
+		UpdatedRows: len(t.rd.DiffRows),
+	}
+	for _, d := range t.rd.DiffRows {
+		rowBefore, rowAfter := d.Row1, d.Row2
+		if reversed {
+			rowBefore, rowAfter = rowAfter, rowBefore
+		}
+		ht.PKCols = rowBefore.PKCols
+		var pk []string
+		for _, pkcn := range rowBefore.PKCols {
+			pk = append(pk, newHTMLCell(rowBefore.ColumnValues[pkcn], "").Text)
+		}
+		for _, cn := range diffColumns(t.cols, d) {
+			ht.Updated = append(ht.Updated, &htmlCellDiff{
+				PrimaryKey: pk,
+				Column:     cn,
+				Before:     newHTMLCell(rowBefore.ColumnValues[cn], "deleted"),
+				After:      newHTMLCell(rowAfter.ColumnValues[cn], "added"),
+			})
+		}
+	}
+	return ht
+}
+
+func newHTMLRows(cols []string, rows []*Row, class string) *htmlRows {
+	hr := &htmlRows{Cols: cols}
+	for _, row := range rows {
+		var cells []*htmlCell
+		for _, cn := range cols {
+			cells = append(cells, newHTMLCell(row.ColumnValues[cn], class))
+		}
+		hr.Rows = append(hr.Rows, cells)
+	}
+	return hr
+}
+
+func newHTMLCell(v ColumnValue, class string) *htmlCell {
+	if NewJSONValue(v).Value == nil {
+		return &htmlCell{Null: true, Class: class}
+	}
+	text, err := textValue(v)
+	if err != nil {
+		text = fmt.Sprintf("%v", v)
+	}
+	return &htmlCell{Text: text, Class: class}
+}
+
+// textValue returns the text of a non-NULL value, which is the JSONValue encoding with strings unquoted
+func textValue(v ColumnValue) (string, error) {
+	jv := NewJSONValue(v).Value
+	switch tv := jv.(type) {
+	case string:
+		return tv, nil
+	case []interface{}:
+		b, err := json.Marshal(tv)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return fmt.Sprintf("%v", jv), nil
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLReport(t *testing.T) {
+	pks := []string{"id"}
+	r, err := NewHTMLReport("Migration", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddTable("Singers", []string{"id", "name"}, &RowsDiff{
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": int64(2), "name": nil}}},
+		DiffRows: []*RowDiff{{
+			[]interface{}{int64(3)},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "<b>before</b>"}},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "after"}},
+		}},
+	})
+	r.AddTable("Albums", []string{"id"}, &RowsDiff{})
+	r.AddTableOnlyOn("Venues", "server2")
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	assert.True(t, strings.Index(html, `id="table-Albums"`) < strings.Index(html, `id="table-Singers"`))
+	assert.Contains(t, html, `<td class="deleted">&lt;b&gt;before&lt;/b&gt;</td><td class="added">after</td>`)
+	assert.Contains(t, html, `<td class="added"><span class="null">NULL</span></td>`)
+	assert.Contains(t, html, "No diff found")
+	assert.Contains(t, html, `<td class="ng">TABLE added</td>`)
+	assert.NotContains(t, html, "<b>before</b>")
+	assert.NotContains(t, html, "http")
+	assert.NotContains(t, html, "Read timestamp")
+
+	buf.Reset()
+	r.SetReadTimestamps("2020-01-29T12:00:00Z", "strong")
+	if err := r.Write(&buf, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), "<tr><td>server1</td><td>2020-01-29T12:00:00Z</td></tr>")
+
+	if err := r.Write(&buf, "server3"); err == nil {
+		t.Fatal("error expected for invalid changesFor")
+	}
+}
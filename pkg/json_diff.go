@@ -0,0 +1,530 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+)
+
+// JSONValue is a column value with its Spanner type.
+// Value is encoded according to Type so that it can be decoded without loss:
+//
+//	BOOL       true/false
+//	INT64      decimal string (e.g. "123"), since JSON numbers may lose precision
+//	FLOAT64    number, or "NaN", "Infinity", "-Infinity"
+//	NUMERIC    decimal string with 9 fractional digits (e.g. "1.500000000")
+//	STRING     string
+//	BYTES      base64 string
+//	DATE       "YYYY-MM-DD"
+//	TIMESTAMP  RFC 3339 string in UTC with nanoseconds (e.g. "2020-01-29T12:00:00.123456789Z")
+//	ARRAY      array of the values of ArrayElementType
+//	STRUCT     string representation (not decodable)
+//
+// NULL is encoded as null. ArrayElementType is set only for ARRAY.
+type JSONValue struct {
+	Type             ValueType   `json:"type"`
+	ArrayElementType ValueType   `json:"array_element_type,omitempty"`
+	Value            interface{} `json:"value"`
+}
+
+// NewJSONValue encodes a column value
+func NewJSONValue(v ColumnValue) *JSONValue {
+	typ, nv := normalizeValue(v)
+	jv := &JSONValue{Type: typ}
+	if typ != TypeArray {
+		jv.Value = encodeJSONScalar(typ, nv)
+		return jv
+	}
+	jv.ArrayElementType = arrayElementType(v)
+	if nv == nil {
+		return jv
+	}
+	elems := []interface{}{}
+	for _, elem := range nv.([]interface{}) {
+		etyp, env := normalizeValue(elem)
+		if jv.ArrayElementType == TypeUnknown {
+			jv.ArrayElementType = etyp
+		}
+		elems = append(elems, encodeJSONScalar(etyp, env))
+	}
+	jv.Value = elems
+	return jv
+}
+
+// arrayElementType returns the element type of a slice from its Go type
+func arrayElementType(v ColumnValue) ValueType {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Slice || t.Elem().Kind() == reflect.Interface {
+		return TypeUnknown
+	}
+	typ, _ := normalizeValue(reflect.Zero(t.Elem()).Interface())
+	return typ
+}
+
+func encodeJSONScalar(typ ValueType, nv interface{}) interface{} {
+	if nv == nil {
+		return nil
+	}
+	switch typ {
+	case TypeBool, TypeString:
+		return nv
+	case TypeInt64:
+		return fmt.Sprintf("%d", nv.(int64))
+	case TypeFloat64:
+		f := nv.(float64)
+		switch {
+		case math.IsNaN(f):
+			return "NaN"
+		case math.IsInf(f, 1):
+			return "Infinity"
+		case math.IsInf(f, -1):
+			return "-Infinity"
+		}
+		return f
+	case TypeNumeric:
+		return nv.(*big.Rat).FloatString(9)
+	case TypeBytes:
+		return base64.StdEncoding.EncodeToString(nv.([]byte))
+	case TypeDate:
+		return nv.(civil.Date).String()
+	case TypeTimestamp:
+		return nv.(time.Time).UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%v", nv)
+}
+
+// Decode returns the value as a Go value which can be written to Spanner.
+// NULL is decoded as the spanner.NullXXX of the type, and ARRAY as a slice of spanner.NullXXX ([][]byte for BYTES).
+func (jv *JSONValue) Decode() (interface{}, error) {
+	if jv.Type != TypeArray {
+		return decodeJSONScalar(jv.Type, jv.Value)
+	}
+	var elems []interface{}
+	if jv.Value != nil {
+		var ok bool
+		if elems, ok = jv.Value.([]interface{}); !ok {
+			return nil, fmt.Errorf("invalid ARRAY value: %v", jv.Value)
+		}
+	}
+	decoded := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		v, err := decodeJSONScalar(jv.ArrayElementType, elem)
+		if err != nil {
+			return nil, err
+		}
+		decoded[i] = v
+	}
+	return makeTypedArray(jv.ArrayElementType, decoded, jv.Value == nil)
+}
+
+func decodeJSONScalar(typ ValueType, v interface{}) (interface{}, error) {
+	switch typ {
+	case TypeUnknown:
+		if v != nil {
+			return nil, fmt.Errorf("unknown type of value: %v", v)
+		}
+		return nil, nil
+	case TypeBool:
+		if v == nil {
+			return spanner.NullBool{}, nil
+		}
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case TypeInt64:
+		if v == nil {
+			return spanner.NullInt64{}, nil
+		}
+		if s, ok := v.(string); ok {
+			return strconv.ParseInt(s, 10, 64)
+		}
+	case TypeFloat64:
+		if v == nil {
+			return spanner.NullFloat64{}, nil
+		}
+		switch tv := v.(type) {
+		case float64:
+			return tv, nil
+		case string:
+			switch tv {
+			case "NaN":
+				return math.NaN(), nil
+			case "Infinity":
+				return math.Inf(1), nil
+			case "-Infinity":
+				return math.Inf(-1), nil
+			}
+		}
+	case TypeNumeric:
+		if v == nil {
+			return (*big.Rat)(nil), nil
+		}
+		if s, ok := v.(string); ok {
+			if r, ok := new(big.Rat).SetString(s); ok {
+				return r, nil
+			}
+		}
+	case TypeString:
+		if v == nil {
+			return spanner.NullString{}, nil
+		}
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case TypeBytes:
+		if v == nil {
+			return []byte(nil), nil
+		}
+		if s, ok := v.(string); ok {
+			return base64.StdEncoding.DecodeString(s)
+		}
+	case TypeDate:
+		if v == nil {
+			return spanner.NullDate{}, nil
+		}
+		if s, ok := v.(string); ok {
+			return civil.ParseDate(s)
+		}
+	case TypeTimestamp:
+		if v == nil {
+			return spanner.NullTime{}, nil
+		}
+		if s, ok := v.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s values cannot be decoded", typ)
+	}
+	return nil, fmt.Errorf("invalid %s value: %v", typ, v)
+}
+
+// makeTypedArray converts decoded elements into the slice type which Spanner accepts for ARRAY<typ>
+func makeTypedArray(typ ValueType, elems []interface{}, null bool) (interface{}, error) {
+	switch typ {
+	case TypeBool:
+		a := make([]spanner.NullBool, len(elems))
+		for i, elem := range elems {
+			if b, ok := elem.(bool); ok {
+				a[i] = spanner.NullBool{Bool: b, Valid: true}
+			}
+		}
+		return nilIfNull(a, null), nil
+	case TypeInt64:
+		a := make([]spanner.NullInt64, len(elems))
+		for i, elem := range elems {
+			if n, ok := elem.(int64); ok {
+				a[i] = spanner.NullInt64{Int64: n, Valid: true}
+			}
+		}
+		return nilIfNull(a, null), nil
+	case TypeFloat64:
+		a := make([]spanner.NullFloat64, len(elems))
+		for i, elem := range elems {
+			if f, ok := elem.(float64); ok {
+				a[i] = spanner.NullFloat64{Float64: f, Valid: true}
+			}
+		}
+		return nilIfNull(a, null), nil
+	case TypeString:
+		a := make([]spanner.NullString, len(elems))
+		for i, elem := range elems {
+			if s, ok := elem.(string); ok {
+				a[i] = spanner.NullString{StringVal: s, Valid: true}
+			}
+		}
+		return nilIfNull(a, null), nil
+	case TypeBytes:
+		a := make([][]byte, len(elems))
+		for i, elem := range elems {
+			a[i] = elem.([]byte)
+		}
+		return nilIfNull(a, null), nil
+	case TypeDate:
+		a := make([]spanner.NullDate, len(elems))
+		for i, elem := range elems {
+			if d, ok := elem.(civil.Date); ok {
+				a[i] = spanner.NullDate{Date: d, Valid: true}
+			}
+		}
+		return nilIfNull(a, null), nil
+	case TypeTimestamp:
+		a := make([]spanner.NullTime, len(elems))
+		for i, elem := range elems {
+			if t, ok := elem.(time.Time); ok {
+				a[i] = spanner.NullTime{Time: t, Valid: true}
+			}
+		}
+		return nilIfNull(a, null), nil
+	}
+	return nil, fmt.Errorf("ARRAY<%s> values cannot be decoded", typ)
+}
+
+// nilIfNull returns a nil slice of the type of a for NULL arrays
+func nilIfNull(a interface{}, null bool) interface{} {
+	if !null {
+		return a
+	}
+	return reflect.Zero(reflect.TypeOf(a)).Interface()
+}
+
+// JSONRow is a row added or deleted
+type JSONRow struct {
+	PrimaryKey []*JSONValue          `json:"primary_key"`
+	Values     map[string]*JSONValue `json:"values"`
+}
+
+// JSONRowDiff is a row updated. Before and After have the primary key and the differing columns.
+type JSONRowDiff struct {
+	PrimaryKey []*JSONValue          `json:"primary_key"`
+	Before     map[string]*JSONValue `json:"before"`
+	After      map[string]*JSONValue `json:"after"`
+}
+
+type JSONSummary struct {
+	Added   int `json:"added"`
+	Deleted int `json:"deleted"`
+	Updated int `json:"updated"`
+}
+
+// JSONSchemaVersion is the version of the schema of JSONTableDiff and JSONLine, which is incremented on incompatible changes
+const JSONSchemaVersion = 1
+
+// JSONTableDiff is the document written for each table by JSONDiff.
+// Before is the label of changesFor and the rows are added, deleted or updated to make it After.
+// ReadTimestamps maps the labels to the timestamps at which the rows were read, if they are set.
+// TableChange is "added" or "deleted" if the table exists on only either database, whose rows are not compared.
+type JSONTableDiff struct {
+	Version        int               `json:"version"`
+	Table          string            `json:"table"`
+	Before         string            `json:"before"`
+	After          string            `json:"after"`
+	ReadTimestamps map[string]string `json:"read_timestamps,omitempty"`
+	TableChange    string            `json:"table_change,omitempty"`
+	Summary        *JSONSummary      `json:"summary"`
+	Added          []*JSONRow        `json:"added"`
+	Deleted        []*JSONRow        `json:"deleted"`
+	Updated        []*JSONRowDiff    `json:"updated"`
+}
+
+// JSONLine is a line written by JSONDiff in JSON Lines mode.
+// A line is written for each row with Change "added", "deleted" or "updated",
+// followed by a line with Change "summary" for each table, which also has ReadTimestamps.
+// A table existing on only either database is a line with Change "table_added" or "table_deleted".
+type JSONLine struct {
+	Version        int                   `json:"version"`
+	Table          string                `json:"table"`
+	Change         string                `json:"change"`
+	PrimaryKey     []*JSONValue          `json:"primary_key,omitempty"`
+	Values         map[string]*JSONValue `json:"values,omitempty"`
+	Before         map[string]*JSONValue `json:"before,omitempty"`
+	After          map[string]*JSONValue `json:"after,omitempty"`
+	Summary        *JSONSummary          `json:"summary,omitempty"`
+	ReadTimestamps map[string]string     `json:"read_timestamps,omitempty"`
+}
+
+// JSONDiff writes RowsDiff as a JSONTableDiff document, or as JSON Lines of JSONLine
+type JSONDiff struct {
+	w          io.Writer
+	table      string
+	rows1Label string
+	rows2Label string
+	readTs     map[string]string
+	lines      bool
+}
+
+func NewJSONDiff(w io.Writer, table, rows1Label, rows2Label string) (*JSONDiff, error) {
+	return &JSONDiff{
+		w:          w,
+		table:      table,
+		rows1Label: rows1Label,
+		rows2Label: rows2Label,
+	}, nil
+}
+
+func NewJSONLinesDiff(w io.Writer, table, rows1Label, rows2Label string) (*JSONDiff, error) {
+	jd, err := NewJSONDiff(w, table, rows1Label, rows2Label)
+	if err != nil {
+		return nil, err
+	}
+	jd.lines = true
+	return jd, nil
+}
+
+// SetReadTimestamps sets the timestamps (or timestamp bounds) at which rows1 and rows2 were read, to be written with the differences
+func (jd *JSONDiff) SetReadTimestamps(rows1, rows2 string) {
+	jd.readTs = map[string]string{jd.rows1Label: rows1, jd.rows2Label: rows2}
+}
+
+func (jd *JSONDiff) Write(rd *RowsDiff, changesFor string) error {
+	if changesFor != jd.rows1Label && changesFor != jd.rows2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", jd.rows1Label, jd.rows2Label)
+	}
+	if !jd.lines {
+		return json.NewEncoder(jd.w).Encode(jd.document(rd, changesFor))
+	}
+
+	h, err := jd.LinesHandler(changesFor)
+	if err != nil {
+		return err
+	}
+	rowsAdded, rowsDeleted := rd.Rows2Only, rd.Rows1Only
+	if h.reversed {
+		rowsAdded, rowsDeleted = rowsDeleted, rowsAdded
+	}
+	for _, row := range rowsAdded {
+		if err := h.writeRow("added", row); err != nil {
+			return err
+		}
+	}
+	for _, row := range rowsDeleted {
+		if err := h.writeRow("deleted", row); err != nil {
+			return err
+		}
+	}
+	for _, d := range rd.DiffRows {
+		if err := h.OnDiffRow(d); err != nil {
+			return err
+		}
+	}
+	return h.WriteSummary()
+}
+
+// WriteTableOnlyOn writes that the table exists only on the database labeled onlyOn
+func (jd *JSONDiff) WriteTableOnlyOn(onlyOn, changesFor string) error {
+	if changesFor != jd.rows1Label && changesFor != jd.rows2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", jd.rows1Label, jd.rows2Label)
+	}
+	if onlyOn != jd.rows1Label && onlyOn != jd.rows2Label {
+		return fmt.Errorf("onlyOn must be '%s' or '%s'", jd.rows1Label, jd.rows2Label)
+	}
+	change := tableChange(onlyOn, changesFor)
+	enc := json.NewEncoder(jd.w)
+	if jd.lines {
+		return enc.Encode(&JSONLine{Version: JSONSchemaVersion, Table: jd.table, Change: "table_" + change, ReadTimestamps: jd.readTs})
+	}
+	doc := jd.document(&RowsDiff{}, changesFor)
+	doc.TableChange = change
+	return enc.Encode(doc)
+}
+
+// LinesHandler returns a RowsDiffHandler writing the differences as JSON Lines as soon as they are found,
+// for the tables too large to hold their RowsDiff in memory
+func (jd *JSONDiff) LinesHandler(changesFor string) (*JSONLinesHandler, error) {
+	if changesFor != jd.rows1Label && changesFor != jd.rows2Label {
+		return nil, fmt.Errorf("changesFor must be '%s' or '%s'", jd.rows1Label, jd.rows2Label)
+	}
+	return &JSONLinesHandler{
+		jd:       jd,
+		enc:      json.NewEncoder(jd.w),
+		reversed: changesFor == jd.rows2Label,
+		summary:  &JSONSummary{},
+	}, nil
+}
+
+// JSONLinesHandler writes a JSONLine for each difference passed. WriteSummary writes the summary line at the end of the table.
+type JSONLinesHandler struct {
+	jd       *JSONDiff
+	enc      *json.Encoder
+	reversed bool
+	summary  *JSONSummary
+}
+
+func (h *JSONLinesHandler) OnRows1Only(row *Row) error {
+	if h.reversed {
+		return h.writeRow("added", row)
+	}
+	return h.writeRow("deleted", row)
+}
+
+func (h *JSONLinesHandler) OnRows2Only(row *Row) error {
+	if h.reversed {
+		return h.writeRow("deleted", row)
+	}
+	return h.writeRow("added", row)
+}
+
+func (h *JSONLinesHandler) OnDiffRow(d *RowDiff) error {
+	rowBefore, rowAfter := d.Row1, d.Row2
+	if h.reversed {
+		rowBefore, rowAfter = rowAfter, rowBefore
+	}
+	h.summary.Updated++
+	return h.enc.Encode(&JSONLine{Version: JSONSchemaVersion, Table: h.jd.table, Change: "updated", PrimaryKey: jsonPrimaryKey(rowBefore), Before: jsonValues(rowBefore), After: jsonValues(rowAfter)})
+}
+
+func (h *JSONLinesHandler) writeRow(change string, row *Row) error {
+	if change == "added" {
+		h.summary.Added++
+	} else {
+		h.summary.Deleted++
+	}
+	return h.enc.Encode(&JSONLine{Version: JSONSchemaVersion, Table: h.jd.table, Change: change, PrimaryKey: jsonPrimaryKey(row), Values: jsonValues(row)})
+}
+
+// WriteSummary writes the summary line of the differences passed
+func (h *JSONLinesHandler) WriteSummary() error {
+	return h.enc.Encode(&JSONLine{Version: JSONSchemaVersion, Table: h.jd.table, Change: "summary", Summary: h.summary, ReadTimestamps: h.jd.readTs})
+}
+
+func (jd *JSONDiff) document(rd *RowsDiff, changesFor string) *JSONTableDiff {
+	before, after := jd.rows1Label, jd.rows2Label
+	rowsAdded, rowsDeleted := rd.Rows2Only, rd.Rows1Only
+	if changesFor == jd.rows2Label {
+		before, after = after, before
+		rowsAdded, rowsDeleted = rowsDeleted, rowsAdded
+	}
+
+	doc := &JSONTableDiff{
+		Version:        JSONSchemaVersion,
+		Table:          jd.table,
+		Before:         before,
+		After:          after,
+		ReadTimestamps: jd.readTs,
+		Added:          []*JSONRow{},
+		Deleted:        []*JSONRow{},
+		Updated:        []*JSONRowDiff{},
+	}
+	for _, row := range rowsAdded {
+		doc.Added = append(doc.Added, &JSONRow{PrimaryKey: jsonPrimaryKey(row), Values: jsonValues(row)})
+	}
+	for _, row := range rowsDeleted {
+		doc.Deleted = append(doc.Deleted, &JSONRow{PrimaryKey: jsonPrimaryKey(row), Values: jsonValues(row)})
+	}
+	for _, d := range rd.DiffRows {
+		rowBefore, rowAfter := d.Row1, d.Row2
+		if changesFor == jd.rows2Label {
+			rowBefore, rowAfter = rowAfter, rowBefore
+		}
+		doc.Updated = append(doc.Updated, &JSONRowDiff{PrimaryKey: jsonPrimaryKey(rowBefore), Before: jsonValues(rowBefore), After: jsonValues(rowAfter)})
+	}
+	doc.Summary = &JSONSummary{Added: len(doc.Added), Deleted: len(doc.Deleted), Updated: len(doc.Updated)}
+	return doc
+}
+
+func jsonPrimaryKey(row *Row) []*JSONValue {
+	var pk []*JSONValue
+	for _, pkcn := range row.PKCols {
+		pk = append(pk, NewJSONValue(row.ColumnValues[pkcn]))
+	}
+	return pk
+}
+
+func jsonValues(row *Row) map[string]*JSONValue {
+	values := make(map[string]*JSONValue)
+	for cn, cv := range row.ColumnValues {
+		values[cn] = NewJSONValue(cv)
+	}
+	return values
+}
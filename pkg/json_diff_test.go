@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJSONValue(t *testing.T) {
+	ts := time.Date(2020, 1, 29, 21, 0, 0, 123456789, time.FixedZone("JST", 9*60*60))
+	cases := []struct {
+		v    ColumnValue
+		want string
+	}{
+		{nil, `{"type":"","value":null}`},
+		{true, `{"type":"BOOL","value":true}`},
+		{int64(math.MaxInt64), `{"type":"INT64","value":"9223372036854775807"}`},
+		{spanner.NullInt64{}, `{"type":"INT64","value":null}`},
+		{1.5, `{"type":"FLOAT64","value":1.5}`},
+		{math.NaN(), `{"type":"FLOAT64","value":"NaN"}`},
+		{math.Inf(-1), `{"type":"FLOAT64","value":"-Infinity"}`},
+		{big.NewRat(3, 2), `{"type":"NUMERIC","value":"1.500000000"}`},
+		{"a\"b", `{"type":"STRING","value":"a\"b"}`},
+		{[]byte("abc"), `{"type":"BYTES","value":"YWJj"}`},
+		{civil.Date{Year: 2020, Month: 1, Day: 29}, `{"type":"DATE","value":"2020-01-29"}`},
+		{ts, `{"type":"TIMESTAMP","value":"2020-01-29T12:00:00.123456789Z"}`},
+		{[]spanner.NullInt64{{Int64: 1, Valid: true}, {}}, `{"type":"ARRAY","array_element_type":"INT64","value":["1",null]}`},
+		{[]string{}, `{"type":"ARRAY","array_element_type":"STRING","value":[]}`},
+		{[]float64(nil), `{"type":"ARRAY","array_element_type":"FLOAT64","value":null}`},
+	}
+	for _, c := range cases {
+		b, err := json.Marshal(NewJSONValue(c.v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.want, string(b))
+	}
+}
+
+func TestJSONDiff(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{
+		Rows1Only: []*Row{{pks, map[string]ColumnValue{"id": int64(1), "name": "deleted"}}},
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": int64(2), "name": "added"}}},
+		DiffRows: []*RowDiff{{
+			[]interface{}{int64(3)},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "before"}},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "after"}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	jd, err := NewJSONDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.Write(rd, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	var doc JSONTableDiff
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, JSONSchemaVersion, doc.Version)
+	assert.Equal(t, "Singers", doc.Table)
+	assert.Equal(t, "server1", doc.Before)
+	assert.Equal(t, &JSONSummary{Added: 1, Deleted: 1, Updated: 1}, doc.Summary)
+	assert.Equal(t, "added", doc.Added[0].Values["name"].Value)
+	assert.Equal(t, "deleted", doc.Deleted[0].Values["name"].Value)
+	assert.Equal(t, "before", doc.Updated[0].Before["name"].Value)
+	assert.Equal(t, "after", doc.Updated[0].After["name"].Value)
+	assert.Nil(t, doc.ReadTimestamps)
+
+	buf.Reset()
+	jd, err = NewJSONLinesDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.Write(rd, "server2"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var changes []string
+	for _, line := range lines {
+		var l JSONLine
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, l.Change)
+	}
+	assert.Equal(t, []string{"added", "deleted", "updated", "summary"}, changes)
+	assert.Contains(t, lines[0], `"value":"deleted"`)
+}
+
+func TestJSONDiff_ReadTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	jd, err := NewJSONDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jd.SetReadTimestamps("2020-01-29T12:00:00Z", "strong")
+	if err := jd.Write(&RowsDiff{}, "server2"); err != nil {
+		t.Fatal(err)
+	}
+	var doc JSONTableDiff
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]string{"server1": "2020-01-29T12:00:00Z", "server2": "strong"}, doc.ReadTimestamps)
+
+	buf.Reset()
+	jd, err = NewJSONLinesDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jd.SetReadTimestamps("2020-01-29T12:00:00Z", "strong")
+	if err := jd.Write(&RowsDiff{}, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	var l JSONLine
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "summary", l.Change)
+	assert.Equal(t, "2020-01-29T12:00:00Z", l.ReadTimestamps["server1"])
+}
+
+func TestJSONLinesHandler(t *testing.T) {
+	pks := []string{"id"}
+	var buf bytes.Buffer
+	jd, err := NewJSONLinesDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jd.LinesHandler("server3"); err == nil {
+		t.Fatal("error expected for invalid changesFor")
+	}
+	h, err := jd.LinesHandler("server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lines are written as the differences are passed
+	if err := h.OnRows2Only(&Row{pks, map[string]ColumnValue{"id": int64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), `"change":"deleted"`)
+	if err := h.OnDiffRow(&RowDiff{
+		[]interface{}{int64(2)},
+		&Row{pks, map[string]ColumnValue{"id": int64(2), "name": "server1"}},
+		&Row{pks, map[string]ColumnValue{"id": int64(2), "name": "server2"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.OnRows1Only(&Row{pks, map[string]ColumnValue{"id": int64(3)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.WriteSummary(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []*JSONLine
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var l JSONLine
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, JSONSchemaVersion, l.Version)
+		lines = append(lines, &l)
+	}
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, "updated", lines[1].Change)
+	assert.Equal(t, "server2", lines[1].Before["name"].Value)
+	assert.Equal(t, "added", lines[2].Change)
+	assert.Equal(t, &JSONSummary{Added: 1, Deleted: 1, Updated: 1}, lines[3].Summary)
+}
+
+func TestJSONDiff_WriteTableOnlyOn(t *testing.T) {
+	var buf bytes.Buffer
+	jd, err := NewJSONDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.WriteTableOnlyOn("server2", "server1"); err != nil {
+		t.Fatal(err)
+	}
+	var doc JSONTableDiff
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "added", doc.TableChange)
+	assert.Equal(t, &JSONSummary{}, doc.Summary)
+
+	buf.Reset()
+	jd, err = NewJSONLinesDiff(&buf, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.WriteTableOnlyOn("server2", "server2"); err != nil {
+		t.Fatal(err)
+	}
+	var l JSONLine
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "table_deleted", l.Change)
+
+	if err := jd.WriteTableOnlyOn("server3", "server1"); err == nil {
+		t.Fatal("error expected for invalid onlyOn")
+	}
+}
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+// The first byte of each encoded key part, which makes the parts of different types distinct.
+// NULL is the smallest as in Spanner.
+const (
+	keyTagNull byte = iota + 1
+	keyTagBool
+	keyTagInt64
+	keyTagFloat64
+	keyTagNumeric
+	keyTagString
+	keyTagBytes
+	keyTagTimestamp
+	keyTagDate
+)
+
+// Encode encodes the primary key into a string which identifies the key and can be used as a map key.
+// The strings of two keys of the same types compare as the keys in ascending order, like the key encoding of Spanner.
+func (pk PrimaryKey) Encode() (string, error) {
+	return KeyOrder(nil).Encode(pk)
+}
+
+// Encode encodes the primary key like PrimaryKey.Encode, except that the strings compare as the keys in the order.
+//
+// Each key part is encoded as a tag byte of its type followed by the value:
+// INT64 and FLOAT64 as 8 bytes, TIMESTAMP as 12 bytes and NUMERIC as 16 bytes of the value scaled by 10^9
+// in big endian, flipped to compare as unsigned integers,
+// and STRING and BYTES with 0x00 escaped as 0x00 0xFF and terminated by 0x00 0x01.
+// The bytes of DESC key parts are inverted. Any Go type of a Spanner type (e.g. int, spanner.NullInt64) is encoded
+// the same as the canonical type, so values equal by EqualValues are encoded to the same string,
+// except that NaN equals NaN and -0 equals +0 as they do in key comparison.
+func (o KeyOrder) Encode(pk PrimaryKey) (string, error) {
+	var b []byte
+	for i, v := range pk {
+		start := len(b)
+		var err error
+		if b, err = appendKeyPart(b, v); err != nil {
+			return "", err
+		}
+		if i < len(o) && o[i] {
+			for j := start; j < len(b); j++ {
+				b[j] = ^b[j]
+			}
+		}
+	}
+	return string(b), nil
+}
+
+func appendKeyPart(b []byte, v interface{}) ([]byte, error) {
+	typ, nv := normalizeValue(v)
+	if nv == nil {
+		return append(b, keyTagNull), nil
+	}
+	switch typ {
+	case TypeBool:
+		if nv.(bool) {
+			return append(b, keyTagBool, 1), nil
+		}
+		return append(b, keyTagBool, 0), nil
+	case TypeInt64:
+		return appendUint64(append(b, keyTagInt64), uint64(nv.(int64))^(1<<63)), nil
+	case TypeFloat64:
+		return appendUint64(append(b, keyTagFloat64), orderedFloatBits(nv.(float64))), nil
+	case TypeNumeric:
+		return appendNumeric(append(b, keyTagNumeric), nv.(*big.Rat))
+	case TypeString:
+		return appendEscaped(append(b, keyTagString), []byte(nv.(string))), nil
+	case TypeBytes:
+		return appendEscaped(append(b, keyTagBytes), nv.([]byte)), nil
+	case TypeTimestamp:
+		t := nv.(time.Time)
+		b = appendUint64(append(b, keyTagTimestamp), uint64(t.Unix())^(1<<63))
+		return append(b, byte(t.Nanosecond()>>24), byte(t.Nanosecond()>>16), byte(t.Nanosecond()>>8), byte(t.Nanosecond())), nil
+	case TypeDate:
+		d := nv.(civil.Date)
+		days := d.In(time.UTC).Unix() / (24 * 60 * 60)
+		return appendUint64(append(b, keyTagDate), uint64(days)^(1<<63)), nil
+	}
+	return nil, fmt.Errorf("unsupported type of key value: %T", v)
+}
+
+func appendUint64(b []byte, u uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(b, buf[:]...)
+}
+
+var (
+	numericScale = big.NewInt(1000000000)
+	numericBias  = new(big.Int).Lsh(big.NewInt(1), 127)
+)
+
+// appendNumeric appends r*10^9 + 2^127 as a 128 bit unsigned integer.
+// It covers the range of NUMERIC, 38 digits with 9 digits after the decimal point.
+func appendNumeric(b []byte, r *big.Rat) ([]byte, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(numericScale))
+	if !scaled.IsInt() {
+		return nil, fmt.Errorf("NUMERIC key value has more than 9 digits after the decimal point: %s", r.RatString())
+	}
+	u := new(big.Int).Add(scaled.Num(), numericBias)
+	if u.Sign() < 0 || u.BitLen() > 128 {
+		return nil, fmt.Errorf("NUMERIC key value is out of range: %s", r.RatString())
+	}
+	var buf [16]byte
+	bs := u.Bytes()
+	copy(buf[len(buf)-len(bs):], bs)
+	return append(b, buf[:]...), nil
+}
+
+// orderedFloatBits maps FLOAT64 values to uint64 in the same order, with NaN the smallest
+func orderedFloatBits(f float64) uint64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f == 0:
+		// -0 equals +0
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits | (1 << 63)
+}
+
+// appendEscaped appends bs so that the encoding is ordered and not a prefix of another
+func appendEscaped(b, bs []byte) []byte {
+	for _, c := range bs {
+		if c == 0 {
+			b = append(b, 0, 0xff)
+			continue
+		}
+		b = append(b, c)
+	}
+	return append(b, 0, 1)
+}
@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimaryKey_Encode_Distinct(t *testing.T) {
+	pks := []PrimaryKey{
+		{"a_b", "c"},
+		{"a", "b_c"},
+		{"a\x00", "b"},
+		{"a", "\x00b"},
+		{nil},
+		{""},
+		{"<nil>"},
+		{int64(1)},
+		{"1"},
+		{[]byte("1")},
+		{[]byte{}},
+		{int64(1), int64(2)},
+		{int64(12)},
+	}
+	seen := make(map[string]PrimaryKey)
+	for _, pk := range pks {
+		enc, err := pk.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dup, ok := seen[enc]; ok {
+			t.Fatalf("%#v and %#v have the same encoding", dup, pk)
+		}
+		seen[enc] = pk
+	}
+}
+
+func TestPrimaryKey_Encode_Equal(t *testing.T) {
+	cases := []struct {
+		pk1 PrimaryKey
+		pk2 PrimaryKey
+	}{
+		{PrimaryKey{1}, PrimaryKey{int64(1)}},
+		{PrimaryKey{spanner.NullInt64{Int64: 1, Valid: true}}, PrimaryKey{int64(1)}},
+		{PrimaryKey{spanner.NullString{}}, PrimaryKey{nil}},
+		{PrimaryKey{spanner.NullString{StringVal: "a", Valid: true}}, PrimaryKey{"a"}},
+		{PrimaryKey{math.Copysign(0, -1)}, PrimaryKey{0.0}},
+		{PrimaryKey{*big.NewRat(1, 2)}, PrimaryKey{big.NewRat(2, 4)}},
+		{PrimaryKey{time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("JST", 9*60*60))}, PrimaryKey{time.Date(2006, 1, 2, 6, 4, 5, 0, time.UTC)}},
+	}
+	for _, c := range cases {
+		enc1, err := c.pk1.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc2, err := c.pk2.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, enc1, enc2, "%#v and %#v", c.pk1, c.pk2)
+	}
+}
+
+func TestPrimaryKey_Encode_Unsupported(t *testing.T) {
+	if _, err := (PrimaryKey{[]int64{1}}).Encode(); err == nil {
+		t.Fatal("ARRAY key must fail")
+	}
+	if _, err := (PrimaryKey{big.NewRat(1, 3)}).Encode(); err == nil {
+		t.Fatal("NUMERIC key with more than 9 fractional digits must fail")
+	}
+}
+
+func TestKeyOrder_Encode_Order(t *testing.T) {
+	ts := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	values := [][]interface{}{
+		{nil, false, true},
+		{nil, int64(math.MinInt64), int64(-1), int64(0), int64(1), int64(math.MaxInt64)},
+		{nil, math.NaN(), math.Inf(-1), -1.5, -math.SmallestNonzeroFloat64, 0.0, math.SmallestNonzeroFloat64, 1.5, math.Inf(1)},
+		{nil, big.NewRat(-3, 2), big.NewRat(-1, 1000000000), big.NewRat(0, 1), big.NewRat(1, 1000000000), big.NewRat(3, 2)},
+		{nil, "", "\x00", "\x00\x00", "\x00a", "a", "a\x00", "ab", "b"},
+		{nil, []byte{}, []byte{0}, []byte{0, 0xff}, []byte{1}, []byte{0xff}},
+		{nil, time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), ts.Add(-time.Nanosecond), ts, ts.Add(time.Nanosecond), ts.Add(time.Second)},
+		{nil, civil.Date{Year: 1, Month: 1, Day: 1}, civil.Date{Year: 1969, Month: 12, Day: 31}, civil.Date{Year: 1970, Month: 1, Day: 1}, civil.Date{Year: 9999, Month: 12, Day: 31}},
+	}
+	for _, order := range []KeyOrder{{false, false}, {true, false}, {false, true}, {true, true}} {
+		for _, vs := range values {
+			// composite keys make sure that a part is not mixed with the next part
+			var pks []PrimaryKey
+			for _, v1 := range vs {
+				for _, v2 := range vs {
+					pks = append(pks, PrimaryKey{v1, v2})
+				}
+			}
+			for _, pk1 := range pks {
+				for _, pk2 := range pks {
+					want, err := order.Compare(pk1, pk2)
+					if err != nil {
+						t.Fatal(err)
+					}
+					enc1, err := order.Encode(pk1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					enc2, err := order.Encode(pk2)
+					if err != nil {
+						t.Fatal(err)
+					}
+					assert.Equal(t, want, bytes.Compare([]byte(enc1), []byte(enc2)), "%v: %#v and %#v", order, pk1, pk2)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"cloud.google.com/go/spanner"
+)
+
+type MutationOp string
+
+const (
+	MutationInsertOrUpdate MutationOp = "insert_or_update"
+	MutationUpdate         MutationOp = "update"
+	MutationDelete         MutationOp = "delete"
+)
+
+// Mutation is a serializable form of spanner.Mutation.
+// Values are the values of Columns for insert_or_update and update, and Key is the primary key for delete.
+type Mutation struct {
+	Op      MutationOp   `json:"op"`
+	Table   string       `json:"table"`
+	Columns []string     `json:"columns,omitempty"`
+	Values  []*JSONValue `json:"values,omitempty"`
+	Key     []*JSONValue `json:"key,omitempty"`
+}
+
+// SpannerMutation converts the mutation into spanner.Mutation
+func (m *Mutation) SpannerMutation() (*spanner.Mutation, error) {
+	switch m.Op {
+	case MutationInsertOrUpdate, MutationUpdate:
+		if len(m.Columns) != len(m.Values) {
+			return nil, fmt.Errorf("the number of columns and values of the mutation to %s differ", m.Table)
+		}
+		vals, err := decodeJSONValues(m.Values)
+		if err != nil {
+			return nil, err
+		}
+		if m.Op == MutationUpdate {
+			return spanner.Update(m.Table, m.Columns, vals), nil
+		}
+		return spanner.InsertOrUpdate(m.Table, m.Columns, vals), nil
+	case MutationDelete:
+		key, err := decodeJSONValues(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		return spanner.Delete(m.Table, spanner.Key(key)), nil
+	}
+	return nil, fmt.Errorf("unknown mutation op: %s", m.Op)
+}
+
+func decodeJSONValues(jvs []*JSONValue) ([]interface{}, error) {
+	var vals []interface{}
+	for _, jv := range jvs {
+		v, err := jv.Decode()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// SpannerMutations converts the mutations into spanner.Mutation
+func SpannerMutations(ms []*Mutation) ([]*spanner.Mutation, error) {
+	var sms []*spanner.Mutation
+	for _, m := range ms {
+		sm, err := m.SpannerMutation()
+		if err != nil {
+			return nil, err
+		}
+		sms = append(sms, sm)
+	}
+	return sms, nil
+}
+
+// WriteMutations writes the mutations as JSON Lines, which can be reviewed and read by ReadMutations later
+func WriteMutations(w io.Writer, ms []*Mutation) error {
+	enc := json.NewEncoder(w)
+	for _, m := range ms {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ReadMutations(r io.Reader) ([]*Mutation, error) {
+	var ms []*Mutation
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		m := &Mutation{}
+		if err := dec.Decode(m); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// MutationDiff generates the mutations to make the rows of the table on changesFor the same as the other.
+// Unlike SQLDiff, the rows are labeled apart from the table name since the table has the same name on both databases.
+type MutationDiff struct {
+	rd         *RowsDiff
+	table      string
+	rows1Label string
+	rows2Label string
+}
+
+func NewMutationDiff(rd *RowsDiff, table, rows1Label, rows2Label string) (*MutationDiff, error) {
+	return &MutationDiff{
+		rd:         rd,
+		table:      table,
+		rows1Label: rows1Label,
+		rows2Label: rows2Label,
+	}, nil
+}
+
+// Mutations returns InsertOrUpdate for the rows added, Update of the differing columns for the rows updated
+// and Delete for the rows deleted, applied to the table on changesFor.
+func (md *MutationDiff) Mutations(changesFor string) ([]*Mutation, error) {
+	if changesFor != md.rows1Label && changesFor != md.rows2Label {
+		return nil, fmt.Errorf("changesFor must be '%s' or '%s'", md.rows1Label, md.rows2Label)
+	}
+
+	rowsAdded := md.rd.Rows2Only
+	rowsDeleted := md.rd.Rows1Only
+	if changesFor == md.rows2Label {
+		rowsAdded, rowsDeleted = rowsDeleted, rowsAdded
+	}
+
+	var ms []*Mutation
+	for _, row := range rowsAdded {
+		ms = append(ms, rowMutation(MutationInsertOrUpdate, md.table, md.rd.Columns, row))
+	}
+	for _, rd := range md.rd.DiffRows {
+		updateRow := rd.Row2
+		if changesFor == md.rows2Label {
+			updateRow = rd.Row1
+		}
+		ms = append(ms, rowMutation(MutationUpdate, md.table, md.rd.Columns, updateRow))
+	}
+	for _, row := range rowsDeleted {
+		ms = append(ms, &Mutation{Op: MutationDelete, Table: md.table, Key: jsonPrimaryKey(row)})
+	}
+	return ms, nil
+}
+
+func rowMutation(op MutationOp, table string, tableCols []string, row *Row) *Mutation {
+	m := &Mutation{Op: op, Table: table, Columns: orderedColumns(tableCols, row.ColumnValues)}
+	for _, cn := range m.Columns {
+		m.Values = append(m.Values, NewJSONValue(row.ColumnValues[cn]))
+	}
+	return m
+}
+
+// Count returns the number of mutations counted toward the limit per commit, which is the number of columns
+// for insert_or_update and update, and 1 for delete. Secondary indexes on the columns also count in Spanner.
+func (m *Mutation) Count() int {
+	if m.Op == MutationDelete {
+		return 1
+	}
+	return len(m.Columns)
+}
+
+// SortMutations orders the mutations so that they can be applied to the database of the schema in separate commits:
+// insertions and updates of parent tables precede those of their interleaved children,
+// followed by deletions of children preceding those of their parents.
+// The order of the mutations of a table is kept.
+func SortMutations(ms []*Mutation, s *Schema) []*Mutation {
+	rank := make(map[string]int)
+	for i, t := range sortByInterleaveDepth(s.Tables, false) {
+		rank[t.Name] = i
+	}
+	sorted := make([]*Mutation, len(ms))
+	copy(sorted, ms)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		del1, del2 := sorted[i].Op == MutationDelete, sorted[j].Op == MutationDelete
+		if del1 != del2 {
+			return del2
+		}
+		if del1 {
+			return rank[sorted[i].Table] > rank[sorted[j].Table]
+		}
+		return rank[sorted[i].Table] < rank[sorted[j].Table]
+	})
+	return sorted
+}
+
+// BatchMutations splits the mutations into batches whose counts are at most maxCount, keeping the order
+func BatchMutations(ms []*Mutation, maxCount int) [][]*Mutation {
+	var batches [][]*Mutation
+	var batch []*Mutation
+	count := 0
+	for _, m := range ms {
+		if len(batch) > 0 && count+m.Count() > maxCount {
+			batches = append(batches, batch)
+			batch, count = nil, 0
+		}
+		batch = append(batch, m)
+		count += m.Count()
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
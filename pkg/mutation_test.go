@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutationDiff(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{
+		Rows1Only: []*Row{{pks, map[string]ColumnValue{"id": int64(1), "name": "deleted"}}},
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": int64(2), "name": "added"}}},
+		DiffRows: []*RowDiff{{
+			[]interface{}{int64(3)},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "before"}},
+			&Row{pks, map[string]ColumnValue{"id": int64(3), "name": "after"}},
+		}},
+	}
+	md, err := NewMutationDiff(rd, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := md.Mutations("server1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(ms))
+	assert.Equal(t, MutationInsertOrUpdate, ms[0].Op)
+	assert.Equal(t, []string{"id", "name"}, ms[0].Columns)
+	assert.Equal(t, "added", ms[0].Values[1].Value)
+	assert.Equal(t, MutationUpdate, ms[1].Op)
+	assert.Equal(t, "after", ms[1].Values[1].Value)
+	assert.Equal(t, MutationDelete, ms[2].Op)
+	assert.Equal(t, "Singers", ms[2].Table)
+	assert.Equal(t, "1", ms[2].Key[0].Value)
+
+	var buf bytes.Buffer
+	if err := WriteMutations(&buf, ms); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMutations(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ms, read)
+	if _, err := SpannerMutations(read); err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err = md.Mutations("server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, MutationInsertOrUpdate, ms[0].Op)
+	assert.Equal(t, "deleted", ms[0].Values[1].Value)
+	assert.Equal(t, "before", ms[1].Values[1].Value)
+	assert.Equal(t, "2", ms[2].Key[0].Value)
+
+	if _, err := md.Mutations("server3"); err == nil {
+		t.Fatal("error expected for invalid changesFor")
+	}
+}
+
+func TestJSONValue_Decode(t *testing.T) {
+	ts := time.Date(2020, 1, 29, 12, 0, 0, 123456789, time.UTC)
+	values := []ColumnValue{
+		nil,
+		true,
+		spanner.NullBool{},
+		int64(math.MaxInt64),
+		spanner.NullInt64{},
+		math.NaN(),
+		math.Inf(1),
+		1.5,
+		"abc",
+		spanner.NullString{},
+		[]byte("abc"),
+		[]byte(nil),
+		civil.Date{Year: 2020, Month: 1, Day: 29},
+		ts,
+		spanner.NullTime{},
+		[]spanner.NullInt64{{Int64: 1, Valid: true}, {}},
+		[]string{"a", "b"},
+		[][]byte{[]byte("a"), nil},
+		[]spanner.NullTime(nil),
+	}
+	for _, v := range values {
+		var buf bytes.Buffer
+		if err := WriteMutations(&buf, []*Mutation{{Op: MutationUpdate, Table: "t", Columns: []string{"c"}, Values: []*JSONValue{NewJSONValue(v)}}}); err != nil {
+			t.Fatal(err)
+		}
+		ms, err := ReadMutations(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ms[0].Values[0].Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, TypeOf(v), TypeOf(decoded), "%#v", v)
+		assert.True(t, EqualValues(v, decoded), "%#v != %#v", v, decoded)
+	}
+
+	if _, err := (&JSONValue{Type: TypeInt64, Value: "x"}).Decode(); err == nil {
+		t.Fatal("error expected for invalid INT64")
+	}
+}
+
+func TestSortMutations(t *testing.T) {
+	s := singersSchema()
+	s.Tables = []*TableSchema{s.Tables[1], s.Tables[0]}
+	ms := []*Mutation{
+		{Op: MutationDelete, Table: "Singers"},
+		{Op: MutationInsertOrUpdate, Table: "Albums"},
+		{Op: MutationDelete, Table: "Albums"},
+		{Op: MutationUpdate, Table: "Singers"},
+		{Op: MutationInsertOrUpdate, Table: "Singers"},
+	}
+	var got []string
+	for _, m := range SortMutations(ms, s) {
+		got = append(got, string(m.Op)+" "+m.Table)
+	}
+	assert.Equal(t, []string{
+		"update Singers",
+		"insert_or_update Singers",
+		"insert_or_update Albums",
+		"delete Albums",
+		"delete Singers",
+	}, got)
+}
+
+func TestBatchMutations(t *testing.T) {
+	ms := []*Mutation{
+		{Op: MutationUpdate, Columns: []string{"a", "b"}},
+		{Op: MutationUpdate, Columns: []string{"a", "b"}},
+		{Op: MutationDelete},
+		{Op: MutationInsertOrUpdate, Columns: []string{"a", "b", "c", "d", "e"}},
+		{Op: MutationDelete},
+	}
+	var sizes []int
+	for _, batch := range BatchMutations(ms, 4) {
+		sizes = append(sizes, len(batch))
+	}
+	// a mutation exceeding the limit by itself is a batch of its own
+	assert.Equal(t, []int{2, 1, 1, 1}, sizes)
+}
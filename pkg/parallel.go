@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// TableTask compares a table and writes the result to w
+type TableTask func(ctx context.Context, table string, w io.Writer) error
+
+type tableTaskResult struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+	err error
+	// done is closed when the task finishes
+	done chan struct{}
+}
+
+// Write buffers the output until the output of the preceding tables is written, and then writes it through
+func (res *tableTaskResult) Write(p []byte) (int, error) {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if res.w != nil {
+		return res.w.Write(p)
+	}
+	return res.buf.Write(p)
+}
+
+// writeThrough writes the buffered output to w and makes the following output written to w directly
+func (res *tableTaskResult) writeThrough(w io.Writer) error {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if _, err := res.buf.WriteTo(w); err != nil {
+		return err
+	}
+	res.w = w
+	return nil
+}
+
+// CompareTables runs task for each table, at most parallelism tables at once.
+// The output of each task is written to w in the order of tables, so the output of a table is contiguous
+// and does not depend on scheduling. The output of the first table not finished yet is written to w
+// as it is written by the task, and that of the following tables is buffered until then.
+// When a task fails, the remaining tasks are canceled and the error is returned
+// after writing the output of the preceding tables and the output written by the failed task.
+func CompareTables(ctx context.Context, tables []string, parallelism int, w io.Writer, task TableTask) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*tableTaskResult, len(tables))
+	for i := range results {
+		results[i] = &tableTaskResult{done: make(chan struct{})}
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sem := make(chan struct{}, parallelism)
+		for i, table := range tables {
+			res := results[i]
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				res.err = ctx.Err()
+				close(res.done)
+				continue
+			}
+			wg.Add(1)
+			go func(table string, res *tableTaskResult) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				defer close(res.done)
+				res.err = task(ctx, table, res)
+			}(table, res)
+		}
+	}()
+
+	for _, res := range results {
+		if err := res.writeThrough(w); err != nil {
+			cancel()
+			return err
+		}
+		<-res.done
+		if res.err != nil {
+			cancel()
+			return res.err
+		}
+	}
+	return nil
+}
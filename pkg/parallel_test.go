@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareTables(t *testing.T) {
+	var tables []string
+	var expected string
+	for i := 0; i < 20; i++ {
+		table := fmt.Sprintf("Table%02d", i)
+		tables = append(tables, table)
+		expected += fmt.Sprintf("begin %s\nend %s\n", table, table)
+	}
+
+	var running, maxRunning int32
+	task := func(ctx context.Context, table string, w io.Writer) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		fmt.Fprintf(w, "begin %s\n", table)
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		fmt.Fprintf(w, "end %s\n", table)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := CompareTables(context.Background(), tables, 4, &buf, task); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, buf.String())
+	assert.True(t, maxRunning <= 4)
+}
+
+func TestCompareTables_Error(t *testing.T) {
+	tables := []string{"Table0", "Table1", "Table2", "Table3"}
+	task := func(ctx context.Context, table string, w io.Writer) error {
+		if table == "Table2" {
+			return errors.New("failed")
+		}
+		fmt.Fprintf(w, "%s\n", table)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := CompareTables(context.Background(), tables, 2, &buf, task)
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, "Table0\nTable1\n", buf.String())
+}
+
+func TestCompareTables_WriteThrough(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	read := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.String()
+	}
+	w := writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	})
+
+	written := make(chan struct{})
+	finish := make(chan struct{})
+	task := func(ctx context.Context, table string, w io.Writer) error {
+		fmt.Fprintf(w, "begin %s\n", table)
+		if table == "Table0" {
+			close(written)
+			<-finish
+		}
+		fmt.Fprintf(w, "end %s\n", table)
+		return nil
+	}
+
+	errc := make(chan error)
+	go func() {
+		errc <- CompareTables(context.Background(), []string{"Table0", "Table1"}, 2, w, task)
+	}()
+	<-written
+	// the first table is written while it is running, but the second one waits for it
+	for read() != "begin Table0\n" {
+		time.Sleep(time.Millisecond)
+	}
+	close(finish)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "begin Table0\nend Table0\nbegin Table1\nend Table1\n", read())
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,245 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+)
+
+// KeyRange is a range of the values of the first primary key column, [Start, End).
+// nil Start or End means the range is unbounded. The range with nil Start also includes NULL and NaN,
+// which are smaller than any other value.
+type KeyRange struct {
+	Start interface{}
+	End   interface{}
+}
+
+// SplitKeyRanges splits the table into at most n ranges of roughly the same number of rows
+// by sampling the values of the first primary key column.
+func (s *DataSource) SplitKeyRanges(ctx context.Context, n int) ([]*KeyRange, error) {
+	if len(s.pkColNames) < 1 {
+		return nil, errors.New("at least one of Primary Key is required")
+	}
+	if n <= 1 {
+		return []*KeyRange{{}}, nil
+	}
+
+	stmt := spanner.NewStatement(fmt.Sprintf("SELECT `%s` FROM `%s` TABLESAMPLE RESERVOIR (%d ROWS)", s.pkColNames[0], s.table, n*100))
+	var samples []interface{}
+	if err := s.query(ctx, stmt).Do(func(r *spanner.Row) error {
+		row, err := makeRow(r, s.pkColNames[:1])
+		if err != nil {
+			return err
+		}
+		if v := row.ColumnValues[s.pkColNames[0]]; !isNullValue(v) {
+			samples = append(samples, v)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return splitSamples(samples, n)
+}
+
+// splitSamples returns n ranges split at the quantiles of the samples.
+// NULL and NaN are not split points, since they do not match comparisons in SQL.
+func splitSamples(samples []interface{}, n int) ([]*KeyRange, error) {
+	var valid []interface{}
+	for _, v := range samples {
+		if !isNullValue(v) && !isNaNValue(v) {
+			valid = append(valid, v)
+		}
+	}
+	samples = valid
+
+	var sortErr error
+	sort.Slice(samples, func(i, j int) bool {
+		c, err := compareKeyValues(samples[i], samples[j])
+		if err != nil {
+			sortErr = err
+		}
+		return c < 0
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	var points []interface{}
+	for i := 1; i < n; i++ {
+		idx := len(samples) * i / n
+		if idx >= len(samples) {
+			break
+		}
+		p := samples[idx]
+		// skip duplicated split points, which would make empty ranges
+		if len(points) > 0 {
+			if c, _ := compareKeyValues(points[len(points)-1], p); c == 0 {
+				continue
+			}
+		}
+		points = append(points, p)
+	}
+
+	var ranges []*KeyRange
+	var start interface{}
+	for _, p := range points {
+		ranges = append(ranges, &KeyRange{Start: start, End: p})
+		start = p
+	}
+	ranges = append(ranges, &KeyRange{Start: start})
+	return ranges, nil
+}
+
+func isNaNValue(v interface{}) bool {
+	typ, nv := normalizeValue(v)
+	return typ == TypeFloat64 && nv != nil && math.IsNaN(nv.(float64))
+}
+
+// RowIteratorInRange returns the rows within the range ordered by the primary key
+func (s *DataSource) RowIteratorInRange(ctx context.Context, r *KeyRange) RowIterator {
+	where, params := keyRangeCondition(fmt.Sprintf("`%s`", s.pkColNames[0]), r)
+	stmt := spanner.Statement{
+		SQL:    fmt.Sprintf("SELECT * FROM `%s` %s ORDER BY %s", s.table, where, s.orderByPrimaryKey()),
+		Params: params,
+	}
+	return s.rowIterator(ctx, stmt)
+}
+
+// keyRangeCondition returns the WHERE clause selecting the rows of the key column pk within the range
+func keyRangeCondition(pk string, r *KeyRange) (string, map[string]interface{}) {
+	params := make(map[string]interface{})
+	switch {
+	case r.Start != nil && r.End != nil:
+		params["start"], params["end"] = r.Start, r.End
+		return fmt.Sprintf("WHERE %s >= @start AND %s < @end", pk, pk), params
+	case r.Start != nil:
+		params["start"] = r.Start
+		return fmt.Sprintf("WHERE %s >= @start", pk), params
+	case r.End != nil:
+		params["end"] = r.End
+		// NaN does not match any comparison
+		if typ, _ := normalizeValue(r.End); typ == TypeFloat64 {
+			return fmt.Sprintf("WHERE %s < @end OR %s IS NULL OR IS_NAN(%s)", pk, pk, pk), params
+		}
+		return fmt.Sprintf("WHERE %s < @end OR %s IS NULL", pk, pk), params
+	}
+	return "", params
+}
+
+// ComparePartitioned compares the rows of ds1 and ds2 in each key range, at most parallelism ranges at once,
+// and passes the differences to h in the order of the keys as soon as the preceding ranges are passed.
+// Reading both sides in a read-only transaction (see WithReadOnlyTransaction) makes all the ranges consistent.
+func ComparePartitioned(ctx context.Context, ds1, ds2 *DataSource, cmp RowComparator, ranges []*KeyRange, parallelism int, h RowsDiffHandler) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	// the ranges are ascending, so they are passed in reverse if the first key part is DESC
+	if order := ds1.KeyOrder(); len(order) > 0 && order[0] {
+		reversed := make([]*KeyRange, len(ranges))
+		for i, r := range ranges {
+			reversed[len(ranges)-1-i] = r
+		}
+		ranges = reversed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	results := make([]*rangeResult, len(ranges))
+	for i := range results {
+		results[i] = &rangeResult{done: make(chan struct{})}
+	}
+	indexes := make(chan int)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(indexes)
+		for i, res := range results {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				res.err = ctx.Err()
+				close(res.done)
+			}
+		}
+	}()
+	for w := 0; w < parallelism && w < len(ranges); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res := results[i]
+				res.err = CompareRowIteratorsInOrder(ds1.RowIteratorInRange(ctx, ranges[i]), ds2.RowIteratorInRange(ctx, ranges[i]), ds1.KeyOrder(), cmp, &res.events)
+				close(res.done)
+			}
+		}()
+	}
+
+	for _, res := range results {
+		<-res.done
+		if res.err != nil {
+			return res.err
+		}
+		if err := res.events.replay(h); err != nil {
+			return err
+		}
+		// release the rows passed
+		res.events = nil
+	}
+	return nil
+}
+
+type rangeResult struct {
+	events rowsDiffEvents
+	err    error
+	done   chan struct{}
+}
+
+// rowsDiffEvents records the differences in the order they are found, to pass them to another RowsDiffHandler later
+type rowsDiffEvents []*rowsDiffEvent
+
+type rowsDiffEvent struct {
+	row1Only *Row
+	row2Only *Row
+	diffRow  *RowDiff
+}
+
+func (e *rowsDiffEvents) OnRows1Only(row *Row) error {
+	*e = append(*e, &rowsDiffEvent{row1Only: row})
+	return nil
+}
+
+func (e *rowsDiffEvents) OnRows2Only(row *Row) error {
+	*e = append(*e, &rowsDiffEvent{row2Only: row})
+	return nil
+}
+
+func (e *rowsDiffEvents) OnDiffRow(rd *RowDiff) error {
+	*e = append(*e, &rowsDiffEvent{diffRow: rd})
+	return nil
+}
+
+func (e rowsDiffEvents) replay(h RowsDiffHandler) error {
+	for _, ev := range e {
+		var err error
+		switch {
+		case ev.row1Only != nil:
+			err = h.OnRows1Only(ev.row1Only)
+		case ev.row2Only != nil:
+			err = h.OnRows2Only(ev.row2Only)
+		default:
+			err = h.OnDiffRow(ev.diffRow)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"math"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSamples(t *testing.T) {
+	var samples []interface{}
+	for i := 99; i >= 0; i-- {
+		samples = append(samples, int64(i))
+	}
+
+	{
+		ranges, err := splitSamples(samples, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []*KeyRange{
+			{Start: nil, End: int64(25)},
+			{Start: int64(25), End: int64(50)},
+			{Start: int64(50), End: int64(75)},
+			{Start: int64(75), End: nil},
+		}, ranges)
+	}
+
+	{
+		ranges, err := splitSamples(nil, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []*KeyRange{{}}, ranges)
+	}
+
+	{
+		ranges, err := splitSamples([]interface{}{"a", "a", "a", "b"}, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []*KeyRange{
+			{Start: nil, End: "a"},
+			{Start: "a", End: "b"},
+			{Start: "b", End: nil},
+		}, ranges)
+	}
+}
+
+func TestSplitSamples_NullAndNaN(t *testing.T) {
+	ranges, err := splitSamples([]interface{}{math.NaN(), math.NaN(), nil, spanner.NullFloat64{}, 1.0, 2.0}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*KeyRange{
+		{Start: nil, End: 2.0},
+		{Start: 2.0, End: nil},
+	}, ranges)
+}
+
+func TestKeyRangeCondition(t *testing.T) {
+	cases := []struct {
+		r     *KeyRange
+		where string
+	}{
+		{&KeyRange{}, ""},
+		{&KeyRange{Start: int64(1), End: int64(2)}, "WHERE `id` >= @start AND `id` < @end"},
+		{&KeyRange{Start: int64(1)}, "WHERE `id` >= @start"},
+		{&KeyRange{End: int64(2)}, "WHERE `id` < @end OR `id` IS NULL"},
+		{&KeyRange{End: 2.0}, "WHERE `id` < @end OR `id` IS NULL OR IS_NAN(`id`)"},
+		{&KeyRange{End: spanner.NullFloat64{Float64: 2, Valid: true}}, "WHERE `id` < @end OR `id` IS NULL OR IS_NAN(`id`)"},
+		{&KeyRange{Start: 2.0}, "WHERE `id` >= @start"},
+	}
+	for _, c := range cases {
+		where, params := keyRangeCondition("`id`", c.r)
+		assert.Equal(t, c.where, where)
+		if c.r.Start != nil {
+			assert.Equal(t, c.r.Start, params["start"])
+		}
+		if c.r.End != nil {
+			assert.Equal(t, c.r.End, params["end"])
+		}
+	}
+}
+
+func TestRowsDiffEvents(t *testing.T) {
+	pks := []string{"id"}
+	row1 := &Row{pks, map[string]ColumnValue{"id": int64(1)}}
+	row2 := &Row{pks, map[string]ColumnValue{"id": int64(2)}}
+	diff := &RowDiff{[]interface{}{int64(3)}, row1, row2}
+
+	var events rowsDiffEvents
+	if err := events.OnRows2Only(row2); err != nil {
+		t.Fatal(err)
+	}
+	if err := events.OnDiffRow(diff); err != nil {
+		t.Fatal(err)
+	}
+	if err := events.OnRows1Only(row1); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := &RowsDiff{}
+	if err := events.replay(rd); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &RowsDiff{Rows1Only: []*Row{row1}, Rows2Only: []*Row{row2}, DiffRows: []*RowDiff{diff}}, rd)
+}
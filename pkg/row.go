@@ -1,8 +1,14 @@
 package pkg
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"math/big"
 	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
 )
 
 type ColumnValue interface{}
@@ -22,6 +28,7 @@ func (r *Row) PrimaryKey() PrimaryKey {
 	return pk
 }
 
+// String formats the key for display. Different keys may have the same string, so use Encode to identify keys.
 func (pk PrimaryKey) String() string {
 	var ks []string
 	for _, k := range pk {
@@ -29,3 +36,125 @@ func (pk PrimaryKey) String() string {
 	}
 	return strings.Join(ks, "_")
 }
+
+// KeyOrder is the order of the primary key columns of a table, true for the DESC key parts.
+// The key parts beyond its length are ASC, so nil orders all the key parts ascending.
+type KeyOrder []bool
+
+// Compare compares two primary keys in the order of the keys in Spanner.
+// It returns a negative number if pk1 precedes pk2, zero if pk1 == pk2 and a positive number if pk1 follows pk2.
+func (o KeyOrder) Compare(pk1, pk2 PrimaryKey) (int, error) {
+	if len(pk1) != len(pk2) {
+		return 0, fmt.Errorf("the length of primary keys differs (%d and %d)", len(pk1), len(pk2))
+	}
+	for i := range pk1 {
+		c, err := compareKeyValues(pk1[i], pk2[i])
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 && i < len(o) && o[i] {
+			return -c, nil
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+// comparePrimaryKeys compares two primary keys in the ascending order of Spanner
+func comparePrimaryKeys(pk1, pk2 PrimaryKey) (int, error) {
+	return KeyOrder(nil).Compare(pk1, pk2)
+}
+
+// compareKeyValues compares two values of a key column.
+// NULL is ordered before any other value as Spanner does.
+func compareKeyValues(v1, v2 interface{}) (int, error) {
+	typ1, nv1 := normalizeValue(v1)
+	typ2, nv2 := normalizeValue(v2)
+	switch {
+	case nv1 == nil && nv2 == nil:
+		return 0, nil
+	case nv1 == nil:
+		return -1, nil
+	case nv2 == nil:
+		return 1, nil
+	}
+	if typ1 != typ2 {
+		return 0, fmt.Errorf("cannot compare key values of different types: %T and %T", v1, v2)
+	}
+
+	switch typ1 {
+	case TypeBool:
+		kv1, kv2 := nv1.(bool), nv2.(bool)
+		switch {
+		case kv1 == kv2:
+			return 0, nil
+		case !kv1:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	case TypeInt64:
+		return compareInt64(nv1.(int64), nv2.(int64)), nil
+	case TypeFloat64:
+		kv1, kv2 := nv1.(float64), nv2.(float64)
+		// NaN is the smallest FLOAT64 value in Spanner's ordering
+		nan1, nan2 := math.IsNaN(kv1), math.IsNaN(kv2)
+		switch {
+		case nan1 && nan2:
+			return 0, nil
+		case nan1:
+			return -1, nil
+		case nan2:
+			return 1, nil
+		case kv1 < kv2:
+			return -1, nil
+		case kv1 > kv2:
+			return 1, nil
+		}
+		return 0, nil
+	case TypeNumeric:
+		return nv1.(*big.Rat).Cmp(nv2.(*big.Rat)), nil
+	case TypeString:
+		return strings.Compare(nv1.(string), nv2.(string)), nil
+	case TypeBytes:
+		return bytes.Compare(nv1.([]byte), nv2.([]byte)), nil
+	case TypeTimestamp:
+		kv1, kv2 := nv1.(time.Time), nv2.(time.Time)
+		switch {
+		case kv1.Before(kv2):
+			return -1, nil
+		case kv1.After(kv2):
+			return 1, nil
+		}
+		return 0, nil
+	case TypeDate:
+		kv1, kv2 := nv1.(civil.Date), nv2.(civil.Date)
+		switch {
+		case kv1.Before(kv2):
+			return -1, nil
+		case kv1.After(kv2):
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unsupported type of key value: %T", v1)
+}
+
+func compareInt64(v1, v2 int64) int {
+	switch {
+	case v1 < v2:
+		return -1
+	case v1 > v2:
+		return 1
+	}
+	return 0
+}
+
+// isNullValue reports whether v is NULL.
+// DataSource decodes NULL as an invalid spanner.NullXXX value.
+func isNullValue(v interface{}) bool {
+	_, nv := normalizeValue(v)
+	return nv == nil
+}
@@ -0,0 +1,336 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// Schema is the definition of tables, indexes and foreign keys of a database
+type Schema struct {
+	Tables []*TableSchema
+}
+
+type TableSchema struct {
+	Name        string
+	Columns     []*ColumnSchema
+	PrimaryKey  []*KeyPart
+	ParentTable string
+	// "CASCADE" or "NO ACTION", empty if the table is not interleaved
+	OnDeleteAction string
+	Indexes        []*IndexSchema
+	ForeignKeys    []*ForeignKeySchema
+}
+
+type ColumnSchema struct {
+	Name            string
+	OrdinalPosition int64
+	SpannerType     string
+	IsNullable      bool
+	Options         map[string]string
+}
+
+type KeyPart struct {
+	Column string
+	Desc   bool
+}
+
+type IndexSchema struct {
+	Name           string
+	Table          string
+	IsUnique       bool
+	IsNullFiltered bool
+	// the table the index is interleaved in, empty if not interleaved
+	ParentTable    string
+	Columns        []*KeyPart
+	StoringColumns []string
+}
+
+type ForeignKeySchema struct {
+	Name              string
+	Table             string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+}
+
+func (s *Schema) Table(name string) *TableSchema {
+	for _, t := range s.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (t *TableSchema) Column(name string) *ColumnSchema {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+func (t *TableSchema) ColumnNames() []string {
+	var cns []string
+	for _, col := range t.Columns {
+		cns = append(cns, col.Name)
+	}
+	return cns
+}
+
+// CommitTimestampColumns returns the columns with allow_commit_timestamp=true
+func (t *TableSchema) CommitTimestampColumns() []string {
+	var cns []string
+	for _, col := range t.Columns {
+		if col.AllowCommitTimestamp() {
+			cns = append(cns, col.Name)
+		}
+	}
+	return cns
+}
+
+func (t *TableSchema) Index(name string) *IndexSchema {
+	for _, idx := range t.Indexes {
+		if idx.Name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+func (t *TableSchema) ForeignKey(name string) *ForeignKeySchema {
+	for _, fk := range t.ForeignKeys {
+		if fk.Name == name {
+			return fk
+		}
+	}
+	return nil
+}
+
+func (c *ColumnSchema) AllowCommitTimestamp() bool {
+	return strings.EqualFold(c.Options["allow_commit_timestamp"], "TRUE")
+}
+
+// LoadSchema reads the schema of the database from INFORMATION_SCHEMA
+func LoadSchema(ctx context.Context, client *spanner.Client) (*Schema, error) {
+	s := &Schema{}
+	tables := make(map[string]*TableSchema)
+
+	tstmt := spanner.NewStatement("SELECT TABLE_NAME, PARENT_TABLE_NAME, ON_DELETE_ACTION FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = '' ORDER BY TABLE_NAME")
+	if err := client.Single().Query(ctx, tstmt).Do(func(r *spanner.Row) error {
+		var name string
+		var parent, onDelete spanner.NullString
+		if err := r.Columns(&name, &parent, &onDelete); err != nil {
+			return err
+		}
+		t := &TableSchema{Name: name, ParentTable: parent.StringVal, OnDeleteAction: onDelete.StringVal}
+		tables[name] = t
+		s.Tables = append(s.Tables, t)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	cstmt := spanner.NewStatement("SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, SPANNER_TYPE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = '' ORDER BY TABLE_NAME, ORDINAL_POSITION")
+	if err := client.Single().Query(ctx, cstmt).Do(func(r *spanner.Row) error {
+		var table, name, nullable string
+		var op int64
+		var typ spanner.NullString
+		if err := r.Columns(&table, &name, &op, &typ, &nullable); err != nil {
+			return err
+		}
+		t, ok := tables[table]
+		if !ok {
+			return nil
+		}
+		t.Columns = append(t.Columns, &ColumnSchema{
+			Name:            name,
+			OrdinalPosition: op,
+			SpannerType:     typ.StringVal,
+			IsNullable:      nullable == "YES",
+			Options:         make(map[string]string),
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	ostmt := spanner.NewStatement("SELECT TABLE_NAME, COLUMN_NAME, OPTION_NAME, OPTION_VALUE FROM INFORMATION_SCHEMA.COLUMN_OPTIONS WHERE TABLE_SCHEMA = ''")
+	if err := client.Single().Query(ctx, ostmt).Do(func(r *spanner.Row) error {
+		var table, column, name, value string
+		if err := r.Columns(&table, &column, &name, &value); err != nil {
+			return err
+		}
+		t, ok := tables[table]
+		if !ok {
+			return nil
+		}
+		if col := t.Column(column); col != nil {
+			col.Options[name] = value
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]*IndexSchema)
+	istmt := spanner.NewStatement(`SELECT i.TABLE_NAME, i.INDEX_NAME, i.INDEX_TYPE, i.PARENT_TABLE_NAME, i.IS_UNIQUE, i.IS_NULL_FILTERED, ic.COLUMN_NAME, ic.ORDINAL_POSITION, ic.COLUMN_ORDERING
+FROM INFORMATION_SCHEMA.INDEXES AS i
+JOIN INFORMATION_SCHEMA.INDEX_COLUMNS AS ic
+ON ic.TABLE_SCHEMA = i.TABLE_SCHEMA AND ic.TABLE_NAME = i.TABLE_NAME AND ic.INDEX_NAME = i.INDEX_NAME
+WHERE i.TABLE_SCHEMA = '' AND NOT i.SPANNER_IS_MANAGED
+ORDER BY i.TABLE_NAME, i.INDEX_NAME, ic.ORDINAL_POSITION, ic.COLUMN_NAME`)
+	if err := client.Single().Query(ctx, istmt).Do(func(r *spanner.Row) error {
+		var table, name, typ, parent, column string
+		var unique, nullFiltered bool
+		var op spanner.NullInt64
+		var ordering spanner.NullString
+		if err := r.Columns(&table, &name, &typ, &parent, &unique, &nullFiltered, &column, &op, &ordering); err != nil {
+			return err
+		}
+		t, ok := tables[table]
+		if !ok {
+			return nil
+		}
+		if typ == "PRIMARY_KEY" {
+			t.PrimaryKey = append(t.PrimaryKey, &KeyPart{Column: column, Desc: ordering.StringVal == "DESC"})
+			return nil
+		}
+		key := fmt.Sprintf("%s.%s", table, name)
+		idx, ok := indexes[key]
+		if !ok {
+			idx = &IndexSchema{
+				Name:           name,
+				Table:          table,
+				IsUnique:       unique,
+				IsNullFiltered: nullFiltered,
+				ParentTable:    parent,
+			}
+			indexes[key] = idx
+			t.Indexes = append(t.Indexes, idx)
+		}
+		// storing columns have no ordinal position
+		if !op.Valid {
+			idx.StoringColumns = append(idx.StoringColumns, column)
+			return nil
+		}
+		idx.Columns = append(idx.Columns, &KeyPart{Column: column, Desc: ordering.StringVal == "DESC"})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, idx := range indexes {
+		sort.Strings(idx.StoringColumns)
+	}
+
+	fks := make(map[string]*ForeignKeySchema)
+	fstmt := spanner.NewStatement(`SELECT rc.CONSTRAINT_NAME, kcu.TABLE_NAME, kcu.COLUMN_NAME, ukcu.TABLE_NAME, ukcu.COLUMN_NAME
+FROM INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS AS rc
+JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE AS kcu
+ON kcu.CONSTRAINT_SCHEMA = rc.CONSTRAINT_SCHEMA AND kcu.CONSTRAINT_NAME = rc.CONSTRAINT_NAME
+JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE AS ukcu
+ON ukcu.CONSTRAINT_SCHEMA = rc.UNIQUE_CONSTRAINT_SCHEMA AND ukcu.CONSTRAINT_NAME = rc.UNIQUE_CONSTRAINT_NAME AND ukcu.ORDINAL_POSITION = kcu.POSITION_IN_UNIQUE_CONSTRAINT
+WHERE rc.CONSTRAINT_SCHEMA = ''
+ORDER BY rc.CONSTRAINT_NAME, kcu.ORDINAL_POSITION`)
+	if err := client.Single().Query(ctx, fstmt).Do(func(r *spanner.Row) error {
+		var name, table, column, refTable, refColumn string
+		if err := r.Columns(&name, &table, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		t, ok := tables[table]
+		if !ok {
+			return nil
+		}
+		fk, ok := fks[name]
+		if !ok {
+			fk = &ForeignKeySchema{Name: name, Table: table, ReferencedTable: refTable}
+			fks[name] = fk
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+		fk.Columns = append(fk.Columns, column)
+		fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func quoteIdentifiers(names []string) string {
+	var qs []string
+	for _, name := range names {
+		qs = append(qs, fmt.Sprintf("`%s`", name))
+	}
+	return strings.Join(qs, ", ")
+}
+
+func keyPartsDefinition(kps []*KeyPart) string {
+	var defs []string
+	for _, kp := range kps {
+		def := fmt.Sprintf("`%s`", kp.Column)
+		if kp.Desc {
+			def += " DESC"
+		}
+		defs = append(defs, def)
+	}
+	return strings.Join(defs, ", ")
+}
+
+func columnDefinition(c *ColumnSchema) string {
+	def := fmt.Sprintf("`%s` %s", c.Name, c.SpannerType)
+	if !c.IsNullable {
+		def += " NOT NULL"
+	}
+	if len(c.Options) > 0 {
+		var names []string
+		for name := range c.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var opts []string
+		for _, name := range names {
+			opts = append(opts, fmt.Sprintf("%s = %s", name, strings.ToLower(c.Options[name])))
+		}
+		def += fmt.Sprintf(" OPTIONS (%s)", strings.Join(opts, ", "))
+	}
+	return def
+}
+
+func primaryKeyDefinition(t *TableSchema) string {
+	def := fmt.Sprintf("PRIMARY KEY (%s)", keyPartsDefinition(t.PrimaryKey))
+	if t.ParentTable != "" {
+		def += fmt.Sprintf(", INTERLEAVE IN PARENT `%s`", t.ParentTable)
+		if t.OnDeleteAction != "" {
+			def += fmt.Sprintf(" ON DELETE %s", t.OnDeleteAction)
+		}
+	}
+	return def
+}
+
+func indexDefinition(idx *IndexSchema) string {
+	def := "CREATE"
+	if idx.IsUnique {
+		def += " UNIQUE"
+	}
+	if idx.IsNullFiltered {
+		def += " NULL_FILTERED"
+	}
+	def += fmt.Sprintf(" INDEX `%s` ON `%s` (%s)", idx.Name, idx.Table, keyPartsDefinition(idx.Columns))
+	if len(idx.StoringColumns) > 0 {
+		def += fmt.Sprintf(" STORING (%s)", quoteIdentifiers(idx.StoringColumns))
+	}
+	if idx.ParentTable != "" {
+		def += fmt.Sprintf(", INTERLEAVE IN `%s`", idx.ParentTable)
+	}
+	return def
+}
+
+func foreignKeyDefinition(fk *ForeignKeySchema) string {
+	return fmt.Sprintf("CONSTRAINT `%s` FOREIGN KEY (%s) REFERENCES `%s` (%s)",
+		fk.Name, quoteIdentifiers(fk.Columns), fk.ReferencedTable, quoteIdentifiers(fk.ReferencedColumns))
+}
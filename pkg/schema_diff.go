@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"reflect"
+)
+
+// Differences among schemas
+type SchemaDiff struct {
+	Tables1Only []*TableSchema
+	Tables2Only []*TableSchema
+	DiffTables  []*TableSchemaDiff
+}
+
+// Differences among definitions of a table existing in both schemas
+type TableSchemaDiff struct {
+	Name              string
+	Table1            *TableSchema
+	Table2            *TableSchema
+	Columns1Only      []*ColumnSchema
+	Columns2Only      []*ColumnSchema
+	DiffColumns       []*ColumnSchemaDiff
+	PrimaryKeyDiffers bool
+	InterleaveDiffers bool
+	Indexes1Only      []*IndexSchema
+	Indexes2Only      []*IndexSchema
+	DiffIndexes       []*IndexSchemaDiff
+	ForeignKeys1Only  []*ForeignKeySchema
+	ForeignKeys2Only  []*ForeignKeySchema
+	DiffForeignKeys   []*ForeignKeySchemaDiff
+}
+
+type ColumnSchemaDiff struct {
+	Column1 *ColumnSchema
+	Column2 *ColumnSchema
+}
+
+type IndexSchemaDiff struct {
+	Index1 *IndexSchema
+	Index2 *IndexSchema
+}
+
+type ForeignKeySchemaDiff struct {
+	ForeignKey1 *ForeignKeySchema
+	ForeignKey2 *ForeignKeySchema
+}
+
+func (d *SchemaDiff) HasDiff() bool {
+	return len(d.Tables1Only) > 0 || len(d.Tables2Only) > 0 || len(d.DiffTables) > 0
+}
+
+func (d *TableSchemaDiff) HasDiff() bool {
+	return len(d.Columns1Only) > 0 || len(d.Columns2Only) > 0 || len(d.DiffColumns) > 0 ||
+		d.PrimaryKeyDiffers || d.InterleaveDiffers ||
+		len(d.Indexes1Only) > 0 || len(d.Indexes2Only) > 0 || len(d.DiffIndexes) > 0 ||
+		len(d.ForeignKeys1Only) > 0 || len(d.ForeignKeys2Only) > 0 || len(d.DiffForeignKeys) > 0
+}
+
+func CompareSchemas(s1, s2 *Schema) *SchemaDiff {
+	df := &SchemaDiff{}
+	for _, t1 := range s1.Tables {
+		t2 := s2.Table(t1.Name)
+		if t2 == nil {
+			df.Tables1Only = append(df.Tables1Only, t1)
+			continue
+		}
+		if td := compareTableSchemas(t1, t2); td.HasDiff() {
+			df.DiffTables = append(df.DiffTables, td)
+		}
+	}
+	for _, t2 := range s2.Tables {
+		if s1.Table(t2.Name) == nil {
+			df.Tables2Only = append(df.Tables2Only, t2)
+		}
+	}
+	return df
+}
+
+func compareTableSchemas(t1, t2 *TableSchema) *TableSchemaDiff {
+	td := &TableSchemaDiff{
+		Name:              t1.Name,
+		Table1:            t1,
+		Table2:            t2,
+		PrimaryKeyDiffers: !reflect.DeepEqual(t1.PrimaryKey, t2.PrimaryKey),
+		InterleaveDiffers: t1.ParentTable != t2.ParentTable || t1.OnDeleteAction != t2.OnDeleteAction,
+	}
+
+	for _, c1 := range t1.Columns {
+		c2 := t2.Column(c1.Name)
+		if c2 == nil {
+			td.Columns1Only = append(td.Columns1Only, c1)
+			continue
+		}
+		if !equalColumnSchemas(c1, c2) {
+			td.DiffColumns = append(td.DiffColumns, &ColumnSchemaDiff{Column1: c1, Column2: c2})
+		}
+	}
+	for _, c2 := range t2.Columns {
+		if t1.Column(c2.Name) == nil {
+			td.Columns2Only = append(td.Columns2Only, c2)
+		}
+	}
+
+	for _, idx1 := range t1.Indexes {
+		idx2 := t2.Index(idx1.Name)
+		if idx2 == nil {
+			td.Indexes1Only = append(td.Indexes1Only, idx1)
+			continue
+		}
+		if !reflect.DeepEqual(idx1, idx2) {
+			td.DiffIndexes = append(td.DiffIndexes, &IndexSchemaDiff{Index1: idx1, Index2: idx2})
+		}
+	}
+	for _, idx2 := range t2.Indexes {
+		if t1.Index(idx2.Name) == nil {
+			td.Indexes2Only = append(td.Indexes2Only, idx2)
+		}
+	}
+
+	for _, fk1 := range t1.ForeignKeys {
+		fk2 := t2.ForeignKey(fk1.Name)
+		if fk2 == nil {
+			td.ForeignKeys1Only = append(td.ForeignKeys1Only, fk1)
+			continue
+		}
+		if !reflect.DeepEqual(fk1, fk2) {
+			td.DiffForeignKeys = append(td.DiffForeignKeys, &ForeignKeySchemaDiff{ForeignKey1: fk1, ForeignKey2: fk2})
+		}
+	}
+	for _, fk2 := range t2.ForeignKeys {
+		if t1.ForeignKey(fk2.Name) == nil {
+			td.ForeignKeys2Only = append(td.ForeignKeys2Only, fk2)
+		}
+	}
+	return td
+}
+
+// equalColumnSchemas compares the definition of columns.
+// The ordinal position is not compared because it cannot be changed in Spanner.
+func equalColumnSchemas(c1, c2 *ColumnSchema) bool {
+	if c1.SpannerType != c2.SpannerType || c1.IsNullable != c2.IsNullable {
+		return false
+	}
+	if len(c1.Options) == 0 && len(c2.Options) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(c1.Options, c2.Options)
+}
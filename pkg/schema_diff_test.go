@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func singersSchema() *Schema {
+	return &Schema{Tables: []*TableSchema{
+		{
+			Name: "Singers",
+			Columns: []*ColumnSchema{
+				{Name: "SingerID", OrdinalPosition: 1, SpannerType: "STRING(36)"},
+				{Name: "FirstName", OrdinalPosition: 2, SpannerType: "STRING(1024)", IsNullable: true},
+				{Name: "UpdatedAt", OrdinalPosition: 3, SpannerType: "TIMESTAMP", Options: map[string]string{"allow_commit_timestamp": "TRUE"}},
+			},
+			PrimaryKey: []*KeyPart{{Column: "SingerID"}},
+			Indexes: []*IndexSchema{
+				{Name: "SingersByFirstName", Table: "Singers", Columns: []*KeyPart{{Column: "FirstName"}}},
+			},
+		},
+		{
+			Name: "Albums",
+			Columns: []*ColumnSchema{
+				{Name: "SingerID", OrdinalPosition: 1, SpannerType: "STRING(36)"},
+				{Name: "AlbumID", OrdinalPosition: 2, SpannerType: "INT64"},
+			},
+			PrimaryKey:     []*KeyPart{{Column: "SingerID"}, {Column: "AlbumID"}},
+			ParentTable:    "Singers",
+			OnDeleteAction: "CASCADE",
+		},
+	}}
+}
+
+func TestCompareSchemas_NoDiff(t *testing.T) {
+	sd := CompareSchemas(singersSchema(), singersSchema())
+	assert.Equal(t, false, sd.HasDiff())
+}
+
+func TestCompareSchemas_Tables(t *testing.T) {
+	s1 := singersSchema()
+	s2 := singersSchema()
+	s2.Tables = s2.Tables[:1]
+	s2.Tables = append(s2.Tables, &TableSchema{Name: "Concerts", PrimaryKey: []*KeyPart{{Column: "ConcertID"}}})
+
+	sd := CompareSchemas(s1, s2)
+	assert.Equal(t, true, sd.HasDiff())
+	assert.Equal(t, 1, len(sd.Tables1Only))
+	assert.Equal(t, "Albums", sd.Tables1Only[0].Name)
+	assert.Equal(t, 1, len(sd.Tables2Only))
+	assert.Equal(t, "Concerts", sd.Tables2Only[0].Name)
+	assert.Equal(t, 0, len(sd.DiffTables))
+}
+
+func TestCompareSchemas_Columns(t *testing.T) {
+	s1 := singersSchema()
+	s2 := singersSchema()
+	singers2 := s2.Table("Singers")
+	singers2.Columns[1] = &ColumnSchema{Name: "FirstName", OrdinalPosition: 2, SpannerType: "STRING(MAX)", IsNullable: true}
+	singers2.Columns[2] = &ColumnSchema{Name: "UpdatedAt", OrdinalPosition: 3, SpannerType: "TIMESTAMP"}
+	singers2.Columns = append(singers2.Columns, &ColumnSchema{Name: "LastName", OrdinalPosition: 4, SpannerType: "STRING(1024)"})
+
+	sd := CompareSchemas(s1, s2)
+	assert.Equal(t, true, sd.HasDiff())
+	assert.Equal(t, 1, len(sd.DiffTables))
+	td := sd.DiffTables[0]
+	assert.Equal(t, "Singers", td.Name)
+	assert.Equal(t, 0, len(td.Columns1Only))
+	assert.Equal(t, 1, len(td.Columns2Only))
+	assert.Equal(t, "LastName", td.Columns2Only[0].Name)
+	assert.Equal(t, 2, len(td.DiffColumns))
+	assert.Equal(t, "STRING(1024)", td.DiffColumns[0].Column1.SpannerType)
+	assert.Equal(t, "STRING(MAX)", td.DiffColumns[0].Column2.SpannerType)
+	assert.Equal(t, "UpdatedAt", td.DiffColumns[1].Column1.Name)
+	assert.Equal(t, false, td.PrimaryKeyDiffers)
+	assert.Equal(t, false, td.InterleaveDiffers)
+}
+
+func TestCompareSchemas_KeysAndIndexes(t *testing.T) {
+	s1 := singersSchema()
+	s2 := singersSchema()
+	singers2 := s2.Table("Singers")
+	singers2.Indexes[0] = &IndexSchema{Name: "SingersByFirstName", Table: "Singers", IsUnique: true, Columns: []*KeyPart{{Column: "FirstName"}}}
+	albums2 := s2.Table("Albums")
+	albums2.PrimaryKey = []*KeyPart{{Column: "SingerID"}, {Column: "AlbumID", Desc: true}}
+	albums2.OnDeleteAction = "NO ACTION"
+	albums2.ForeignKeys = []*ForeignKeySchema{{Name: "FK_Singer", Table: "Albums", Columns: []string{"SingerID"}, ReferencedTable: "Singers", ReferencedColumns: []string{"SingerID"}}}
+
+	sd := CompareSchemas(s1, s2)
+	assert.Equal(t, 2, len(sd.DiffTables))
+	assert.Equal(t, "Singers", sd.DiffTables[0].Name)
+	assert.Equal(t, 1, len(sd.DiffTables[0].DiffIndexes))
+	assert.Equal(t, false, sd.DiffTables[0].PrimaryKeyDiffers)
+	assert.Equal(t, "Albums", sd.DiffTables[1].Name)
+	assert.Equal(t, true, sd.DiffTables[1].PrimaryKeyDiffers)
+	assert.Equal(t, true, sd.DiffTables[1].InterleaveDiffers)
+	assert.Equal(t, 1, len(sd.DiffTables[1].ForeignKeys2Only))
+
+	ud, err := NewUnifiedSchemaDiff(os.Stderr, "schema1", "schema2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ud.Write(sd, "schema1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,71 +2,134 @@ package pkg
 
 import (
 	"fmt"
-	"sort"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
 )
 
+// SQLDiff generates DML to apply the differences of the rows on two databases, labeled rows1Label and rows2Label,
+// to the table of the database changed
 type SQLDiff struct {
 	rd         *RowsDiff
 	rows1Table string
 	rows2Table string
+	rows1Label string
+	rows2Label string
 }
 
+// NewSQLDiff generates DML for the tables rows1Table and rows2Table, which are also the labels given as changesFor
 func NewSQLDiff(rd *RowsDiff, rows1Table, rows2Table string) (*SQLDiff, error) {
 	return &SQLDiff{
 		rd:         rd,
 		rows1Table: rows1Table,
 		rows2Table: rows2Table,
+		rows1Label: rows1Table,
+		rows2Label: rows2Table,
+	}, nil
+}
+
+// NewTableSQLDiff generates DML for the table of the same name on the databases labeled rows1Label and rows2Label
+func NewTableSQLDiff(rd *RowsDiff, table, rows1Label, rows2Label string) (*SQLDiff, error) {
+	return &SQLDiff{
+		rd:         rd,
+		rows1Table: table,
+		rows2Table: table,
+		rows1Label: rows1Label,
+		rows2Label: rows2Label,
 	}, nil
 }
 
 func (sd *SQLDiff) SQL(changesFor string) ([]string, error) {
-	if err := sd.validateChangesFor(changesFor); err != nil {
+	rowsAdded, updateRows, rowsDeleted, err := sd.changes(changesFor)
+	if err != nil {
 		return nil, err
 	}
 
+	table := sd.table(changesFor)
 	var sqls []string
+	sqls = append(sqls, insertSQL(table, sd.rd.Columns, rowsAdded)...)
+	sqls = append(sqls, updateSQL(table, sd.rd.Columns, updateRows)...)
+	sqls = append(sqls, deleteSQL(table, rowsDeleted)...)
+	return sqls, nil
+}
+
+// Statements returns the same changes as SQL as statements with query parameters instead of literals,
+// an INSERT, UPDATE or DELETE statement per row.
+func (sd *SQLDiff) Statements(changesFor string) ([]spanner.Statement, error) {
+	rowsAdded, updateRows, rowsDeleted, err := sd.changes(changesFor)
+	if err != nil {
+		return nil, err
+	}
+
+	table := sd.table(changesFor)
+	var stmts []spanner.Statement
+	for _, row := range rowsAdded {
+		stmts = append(stmts, insertStatement(table, sd.rd.Columns, row))
+	}
+	for _, row := range updateRows {
+		stmts = append(stmts, updateStatement(table, sd.rd.Columns, row))
+	}
+	for _, row := range rowsDeleted {
+		stmts = append(stmts, deleteStatement(table, row))
+	}
+	return stmts, nil
+}
+
+// changes returns the rows to insert, update and delete on changesFor
+func (sd *SQLDiff) changes(changesFor string) ([]*Row, []*Row, []*Row, error) {
+	if err := sd.validateChangesFor(changesFor); err != nil {
+		return nil, nil, nil, err
+	}
+
 	rowsAdded := sd.rd.Rows2Only
 	rowsDeleted := sd.rd.Rows1Only
-	if changesFor == sd.rows2Table {
+	if changesFor == sd.rows2Label {
 		rowsAdded, rowsDeleted = rowsDeleted, rowsAdded
 	}
-
-	sqls = append(sqls, insertSQL(changesFor, rowsAdded)...)
 	var updateRows []*Row
 	for _, rd := range sd.rd.DiffRows {
 		updateRow := rd.Row2
-		if changesFor == sd.rows2Table {
+		if changesFor == sd.rows2Label {
 			updateRow = rd.Row1
 		}
 		updateRows = append(updateRows, updateRow)
 	}
-	sqls = append(sqls, updateSQL(changesFor, updateRows)...)
-	sqls = append(sqls, deleteSQL(changesFor, rowsDeleted)...)
-	return sqls, nil
+	return rowsAdded, updateRows, rowsDeleted, nil
+}
+
+// table returns the table of the database labeled changesFor
+func (sd *SQLDiff) table(changesFor string) string {
+	if changesFor == sd.rows2Label {
+		return sd.rows2Table
+	}
+	return sd.rows1Table
 }
 
 func (sd *SQLDiff) validateChangesFor(changesFor string) error {
-	if changesFor != sd.rows1Table && changesFor != sd.rows2Table {
-		return fmt.Errorf("chnagesFor must be '%s' or '%s'", sd.rows1Table, sd.rows2Table)
+	if changesFor != sd.rows1Label && changesFor != sd.rows2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", sd.rows1Label, sd.rows2Label)
 	}
 	return nil
 }
 
-func insertSQL(table string, rows []*Row) []string {
+// insertSQL inserts the rows with the columns in the order of tableCols
+func insertSQL(table string, tableCols []string, rows []*Row) []string {
 	if len(rows) < 1 {
 		return nil
 	}
 
-	var cols []string
+	cols := orderedColumns(tableCols, rows[0].ColumnValues)
 	var qcols []string
-	for cn, _ := range rows[0].ColumnValues {
-		cols = append(cols, cn)
+	for _, cn := range cols {
 		qcols = append(qcols, fmt.Sprintf("`%s`", cn))
 	}
-	sort.Strings(cols)
-	sort.Strings(qcols)
 
 	var vals []string
 	for _, row := range rows {
@@ -79,7 +142,8 @@ func insertSQL(table string, rows []*Row) []string {
 	return []string{fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s", table, strings.Join(qcols, ","), strings.Join(vals, ","))}
 }
 
-func updateSQL(table string, rows []*Row) []string {
+// updateSQL updates the columns of the rows in the order of tableCols
+func updateSQL(table string, tableCols []string, rows []*Row) []string {
 	if len(rows) < 1 {
 		return nil
 	}
@@ -88,11 +152,11 @@ func updateSQL(table string, rows []*Row) []string {
 	for _, row := range rows {
 		var wheres []string
 		for _, pkn := range row.PKCols {
-			wheres = append(wheres, fmt.Sprintf("`%s` = %s", pkn, literal(row.ColumnValues[pkn])))
+			wheres = append(wheres, keyCondition(pkn, row.ColumnValues[pkn]))
 		}
 
 		var sets []string
-		for cn, cv := range row.ColumnValues {
+		for _, cn := range orderedColumns(tableCols, row.ColumnValues) {
 			skip := false
 			for _, pkn := range row.PKCols {
 				if cn == pkn {
@@ -100,7 +164,7 @@ func updateSQL(table string, rows []*Row) []string {
 				}
 			}
 			if !skip {
-				sets = append(sets, fmt.Sprintf("`%s` = %s", cn, literal(cv)))
+				sets = append(sets, fmt.Sprintf("`%s` = %s", cn, literal(row.ColumnValues[cn])))
 			}
 		}
 		sqls = append(sqls, fmt.Sprintf("UPDATE `%s` SET %s WHERE %s", table, strings.Join(sets, ","), strings.Join(wheres, " and ")))
@@ -117,23 +181,194 @@ func deleteSQL(table string, rows []*Row) []string {
 	for _, row := range rows {
 		var wheres []string
 		for _, pkn := range row.PKCols {
-			wheres = append(wheres, fmt.Sprintf("`%s` = %s", pkn, literal(row.ColumnValues[pkn])))
+			wheres = append(wheres, keyCondition(pkn, row.ColumnValues[pkn]))
 		}
 		sqls = append(sqls, fmt.Sprintf("DELETE FROM `%s` WHERE %s", table, strings.Join(wheres, " and ")))
 	}
 	return sqls
 }
 
+// statementParams names query parameters @p1, @p2, ... in the order added
+type statementParams map[string]interface{}
+
+func (ps statementParams) add(v ColumnValue) string {
+	name := fmt.Sprintf("p%d", len(ps)+1)
+	ps[name] = v
+	return "@" + name
+}
+
+// keyConditions returns the conditions on the primary key of the row, with NULL keys matched by IS NULL
+func (ps statementParams) keyConditions(row *Row) string {
+	var wheres []string
+	for _, pkn := range row.PKCols {
+		if _, v := normalizeValue(row.ColumnValues[pkn]); v == nil {
+			wheres = append(wheres, fmt.Sprintf("`%s` IS NULL", pkn))
+		} else {
+			wheres = append(wheres, fmt.Sprintf("`%s` = %s", pkn, ps.add(row.ColumnValues[pkn])))
+		}
+	}
+	return strings.Join(wheres, " and ")
+}
+
+func insertStatement(table string, tableCols []string, row *Row) spanner.Statement {
+	ps := statementParams{}
+	var qcols, vals []string
+	for _, cn := range orderedColumns(tableCols, row.ColumnValues) {
+		qcols = append(qcols, fmt.Sprintf("`%s`", cn))
+		vals = append(vals, ps.add(row.ColumnValues[cn]))
+	}
+	return spanner.Statement{
+		SQL:    fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", table, strings.Join(qcols, ","), strings.Join(vals, ",")),
+		Params: map[string]interface{}(ps),
+	}
+}
+
+func updateStatement(table string, tableCols []string, row *Row) spanner.Statement {
+	isPK := make(map[string]bool)
+	for _, pkn := range row.PKCols {
+		isPK[pkn] = true
+	}
+
+	ps := statementParams{}
+	var sets []string
+	for _, cn := range orderedColumns(tableCols, row.ColumnValues) {
+		if isPK[cn] {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("`%s` = %s", cn, ps.add(row.ColumnValues[cn])))
+	}
+	return spanner.Statement{
+		SQL:    fmt.Sprintf("UPDATE `%s` SET %s WHERE %s", table, strings.Join(sets, ","), ps.keyConditions(row)),
+		Params: map[string]interface{}(ps),
+	}
+}
+
+func deleteStatement(table string, row *Row) spanner.Statement {
+	ps := statementParams{}
+	return spanner.Statement{
+		SQL:    fmt.Sprintf("DELETE FROM `%s` WHERE %s", table, ps.keyConditions(row)),
+		Params: map[string]interface{}(ps),
+	}
+}
+
+func keyCondition(cn string, cv ColumnValue) string {
+	if _, v := normalizeValue(cv); v == nil {
+		return fmt.Sprintf("`%s` IS NULL", cn)
+	}
+	return fmt.Sprintf("`%s` = %s", cn, literal(cv))
+}
+
+// literal renders the value as a GoogleSQL literal of its Spanner type
 func literal(cv ColumnValue) string {
-	switch cv.(type) {
-	case string, *string:
-		return fmt.Sprintf("'%s'", cv)
-	case time.Time:
-		return fmt.Sprintf("'%s'", cv.(time.Time).Format(time.RFC3339Nano))
-	case float32, float64, *float32, *float64:
-		// https://stackoverflow.com/questions/48337330/how-to-print-float-as-string-in-golang-without-scientific-notation
-		return fmt.Sprintf("%f", cv)
-	default:
-		return fmt.Sprintf("%v", cv)
+	typ, v := normalizeValue(cv)
+	if typ == TypeArray {
+		if v == nil {
+			return "NULL"
+		}
+		etyp := arrayElementType(cv)
+		var elems []string
+		for _, elem := range v.([]interface{}) {
+			if etyp == TypeUnknown {
+				etyp = TypeOf(elem)
+			}
+			elems = append(elems, literal(elem))
+		}
+		if etyp == TypeUnknown {
+			return fmt.Sprintf("[%s]", strings.Join(elems, ", "))
+		}
+		return fmt.Sprintf("ARRAY<%s>[%s]", etyp, strings.Join(elems, ", "))
+	}
+	return scalarLiteral(typ, v)
+}
+
+func scalarLiteral(typ ValueType, v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	switch typ {
+	case TypeBool:
+		if v.(bool) {
+			return "TRUE"
+		}
+		return "FALSE"
+	case TypeInt64:
+		return strconv.FormatInt(v.(int64), 10)
+	case TypeFloat64:
+		f := v.(float64)
+		switch {
+		case math.IsNaN(f):
+			return "CAST('nan' AS FLOAT64)"
+		case math.IsInf(f, 1):
+			return "CAST('inf' AS FLOAT64)"
+		case math.IsInf(f, -1):
+			return "CAST('-inf' AS FLOAT64)"
+		case f == 0 && math.Signbit(f):
+			return "CAST('-0' AS FLOAT64)"
+		}
+		// the shortest representation which parses back to the same value
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case TypeNumeric:
+		return fmt.Sprintf("NUMERIC '%s'", v.(*big.Rat).FloatString(9))
+	case TypeString:
+		return quoteString(v.(string))
+	case TypeBytes:
+		return quoteBytes(v.([]byte))
+	case TypeDate:
+		return fmt.Sprintf("DATE '%s'", v.(civil.Date).String())
+	case TypeTimestamp:
+		return fmt.Sprintf("TIMESTAMP '%s'", v.(time.Time).UTC().Format(time.RFC3339Nano))
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// quoteString quotes s as a GoogleSQL string literal, escaping quotes, backslashes and non-printable characters
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch {
+		case r == '\'' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == utf8.RuneError || !unicode.IsPrint(r):
+			if r > 0xffff {
+				fmt.Fprintf(&b, `\U%08x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// quoteBytes quotes bs as a GoogleSQL bytes literal, escaping bytes other than printable ASCII
+func quoteBytes(bs []byte) string {
+	var b strings.Builder
+	b.WriteString(`b"`)
+	for _, c := range bs {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
 	}
+	b.WriteByte('"')
+	return b.String()
 }
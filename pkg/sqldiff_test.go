@@ -1,9 +1,17 @@
 package pkg
 
 import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,18 +22,18 @@ func TestInsertSQL(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	sqls := insertSQL("Singers", []*Row{
+	sqls := insertSQL("Singers", nil, []*Row{
 		{pks, map[string]ColumnValue{"id": "a", "name": "na", "age": 1, "created_at": ts}},
 		{pks, map[string]ColumnValue{"id": "b", "name": "nb", "age": 2, "created_at": ts}},
 	})
 
 	assert.Equal(t, 1, len(sqls))
-	assert.Equal(t, "INSERT INTO `Singers` (`age`,`created_at`,`id`,`name`) VALUES (1,'2006-01-02T15:04:05+09:00','a','na'),(2,'2006-01-02T15:04:05+09:00','b','nb')", sqls[0])
+	assert.Equal(t, "INSERT INTO `Singers` (`age`,`created_at`,`id`,`name`) VALUES (1,TIMESTAMP '2006-01-02T06:04:05Z','a','na'),(2,TIMESTAMP '2006-01-02T06:04:05Z','b','nb')", sqls[0])
 }
 
 func TestUpdateSQL(t *testing.T) {
 	pks := []string{"ida", "idb"}
-	sqls := updateSQL("Singers", []*Row{
+	sqls := updateSQL("Singers", nil, []*Row{
 		{pks, map[string]ColumnValue{"ida": "aa", "idb": "ab", "age": 10}},
 		{pks, map[string]ColumnValue{"ida": "bb", "idb": "bb", "age": 11}},
 	})
@@ -77,3 +85,329 @@ func TestSQLDiff_SQL(t *testing.T) {
 		t.Logf("%s", sql)
 	}
 }
+
+func TestLiteral(t *testing.T) {
+	ts := time.Date(2020, 1, 29, 21, 0, 0, 123456789, time.FixedZone("JST", 9*60*60))
+	cases := []struct {
+		v    ColumnValue
+		want string
+	}{
+		{nil, "NULL"},
+		{spanner.NullString{}, "NULL"},
+		{true, "TRUE"},
+		{int64(-42), "-42"},
+		{1.0, "1.0"},
+		{0.1, "0.1"},
+		{1e100, "1e+100"},
+		{math.NaN(), "CAST('nan' AS FLOAT64)"},
+		{math.Inf(-1), "CAST('-inf' AS FLOAT64)"},
+		{big.NewRat(-3, 2), "NUMERIC '-1.500000000'"},
+		{`it's a \ "test"` + "\n", `'it\'s a \\ "test"\n'`},
+		{[]byte("a\"\x00\xff"), `b"a\"\x00\xff"`},
+		{civil.Date{Year: 2020, Month: 1, Day: 29}, "DATE '2020-01-29'"},
+		{ts, "TIMESTAMP '2020-01-29T12:00:00.123456789Z'"},
+		{[]spanner.NullInt64{{Int64: 1, Valid: true}, {}}, "ARRAY<INT64>[1, NULL]"},
+		{[]string{}, "ARRAY<STRING>[]"},
+		{[]string(nil), "NULL"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, literal(c.v))
+	}
+}
+
+func TestLiteral_RoundTrip(t *testing.T) {
+	values := []ColumnValue{
+		nil,
+		false,
+		int64(math.MinInt64),
+		int64(math.MaxInt64),
+		math.Pi,
+		-1e-300,
+		math.MaxFloat64,
+		math.SmallestNonzeroFloat64,
+		math.Inf(1),
+		math.Copysign(0, -1),
+		big.NewRat(-1234567891, 1000000000),
+		"",
+		"'; DROP TABLE Singers; --",
+		"back\\slash\ttab\r\n",
+		"\x00\x7f​日本語🍣",
+		[]byte{},
+		[]byte("\\\"'\n\x80"),
+		civil.Date{Year: 1, Month: 1, Day: 1},
+		time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC),
+		[]float64{math.NaN(), -0.5},
+		[][]byte{[]byte("x"), nil},
+		[]spanner.NullString{{StringVal: "a'b", Valid: true}, {}},
+		[]civil.Date{{Year: 2020, Month: 2, Day: 29}},
+		[]time.Time{time.Unix(0, 1).UTC()},
+	}
+	for _, v := range values {
+		lit := literal(v)
+		p := &literalParser{s: lit}
+		parsed, err := p.parse()
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", lit, err)
+		}
+		if p.pos != len(p.s) {
+			t.Fatalf("trailing characters in %s", lit)
+		}
+		assert.True(t, (&ValueComparator{SignedZero: SignedZeroDistinct}).Equal(v, parsed), "%s: %#v != %#v", lit, v, parsed)
+	}
+}
+
+// literalParser parses the GoogleSQL literals rendered by literal
+type literalParser struct {
+	s   string
+	pos int
+}
+
+func (p *literalParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *literalParser) parse() (interface{}, error) {
+	switch {
+	case p.consume("NULL"):
+		return nil, nil
+	case p.consume("TRUE"):
+		return true, nil
+	case p.consume("FALSE"):
+		return false, nil
+	case p.consume("CAST("):
+		s, err := p.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(" AS FLOAT64)") {
+			return nil, fmt.Errorf("invalid CAST at %d", p.pos)
+		}
+		return strconv.ParseFloat(string(s), 64)
+	case p.consume("NUMERIC "):
+		s, err := p.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		r, ok := new(big.Rat).SetString(string(s))
+		if !ok {
+			return nil, fmt.Errorf("invalid NUMERIC %s", s)
+		}
+		return r, nil
+	case p.consume("DATE "):
+		s, err := p.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		return civil.ParseDate(string(s))
+	case p.consume("TIMESTAMP "):
+		s, err := p.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, string(s))
+	case p.consume("ARRAY<"):
+		end := strings.Index(p.s[p.pos:], ">[")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid ARRAY at %d", p.pos)
+		}
+		p.pos += end + 2
+		elems := []interface{}{}
+		for !p.consume("]") {
+			if len(elems) > 0 && !p.consume(", ") {
+				return nil, fmt.Errorf("expected , at %d", p.pos)
+			}
+			elem, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	case p.consume("b"):
+		b, err := p.quoted('"')
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case strings.HasPrefix(p.s[p.pos:], "'"):
+		s, err := p.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(s) {
+			return nil, fmt.Errorf("invalid UTF-8 string %q", s)
+		}
+		return string(s), nil
+	}
+	end := p.pos
+	for end < len(p.s) && strings.ContainsRune("0123456789+-.e", rune(p.s[end])) {
+		end++
+	}
+	num := p.s[p.pos:end]
+	p.pos = end
+	if strings.ContainsAny(num, ".e") {
+		return strconv.ParseFloat(num, 64)
+	}
+	return strconv.ParseInt(num, 10, 64)
+}
+
+func (p *literalParser) quoted(q byte) ([]byte, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != q {
+		return nil, fmt.Errorf("expected %c at %d", q, p.pos)
+	}
+	p.pos++
+	b := []byte{}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == q:
+			return b, nil
+		case c == '\\':
+			if p.pos >= len(p.s) {
+				return nil, fmt.Errorf("unterminated escape")
+			}
+			e := p.s[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if p.pos+n > len(p.s) {
+					return nil, fmt.Errorf("invalid escape")
+				}
+				code, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+				if err != nil {
+					return nil, err
+				}
+				p.pos += n
+				if e == 'x' {
+					b = append(b, byte(code))
+				} else {
+					b = append(b, string(rune(code))...)
+				}
+			default:
+				b = append(b, e)
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+	return nil, fmt.Errorf("unterminated quote")
+}
+
+func TestSQLDiff_Statements(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{
+		Rows1Only: []*Row{{pks, map[string]ColumnValue{"id": "a", "name": "a'name"}}},
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": "b", "name": "b-name", "age": int64(2)}}},
+		DiffRows: []*RowDiff{{PrimaryKey{"c"},
+			&Row{pks, map[string]ColumnValue{"id": "c", "name": "c-name"}},
+			&Row{pks, map[string]ColumnValue{"id": "c", "name": "c-name-alt"}},
+		}},
+	}
+	sd, err := NewSQLDiff(rd, "Table1", "Table2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := sd.Statements("Table1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []spanner.Statement{
+		{SQL: "INSERT INTO `Table1` (`age`,`id`,`name`) VALUES (@p1,@p2,@p3)", Params: map[string]interface{}{"p1": int64(2), "p2": "b", "p3": "b-name"}},
+		{SQL: "UPDATE `Table1` SET `name` = @p1 WHERE `id` = @p2", Params: map[string]interface{}{"p1": "c-name-alt", "p2": "c"}},
+		{SQL: "DELETE FROM `Table1` WHERE `id` = @p1", Params: map[string]interface{}{"p1": "a"}},
+	}, stmts)
+
+	stmts, err = sd.Statements("Table2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "INSERT INTO `Table2` (`id`,`name`) VALUES (@p1,@p2)", stmts[0].SQL)
+	assert.Equal(t, "a'name", stmts[0].Params["p2"])
+}
+
+func TestTableSQLDiff(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{
+		Rows1Only: []*Row{{pks, map[string]ColumnValue{"id": "a", "name": "a-name"}}},
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": "b", "name": "b-name"}}},
+		DiffRows: []*RowDiff{{PrimaryKey{"c"},
+			&Row{pks, map[string]ColumnValue{"id": "c", "name": "c-name"}},
+			&Row{pks, map[string]ColumnValue{"id": "c", "name": "c-name-alt"}},
+		}},
+	}
+	sd, err := NewTableSQLDiff(rd, "Singers", "server1", "server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqls, err := sd.SQL("server1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"INSERT INTO `Singers` (`id`,`name`) VALUES ('b','b-name')",
+		"UPDATE `Singers` SET `name` = 'c-name-alt' WHERE `id` = 'c'",
+		"DELETE FROM `Singers` WHERE `id` = 'a'",
+	}, sqls)
+
+	sqls, err = sd.SQL("server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"INSERT INTO `Singers` (`id`,`name`) VALUES ('a','a-name')",
+		"UPDATE `Singers` SET `name` = 'c-name' WHERE `id` = 'c'",
+		"DELETE FROM `Singers` WHERE `id` = 'b'",
+	}, sqls)
+
+	stmts, err := sd.Statements("server2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []spanner.Statement{
+		{SQL: "INSERT INTO `Singers` (`id`,`name`) VALUES (@p1,@p2)", Params: map[string]interface{}{"p1": "a", "p2": "a-name"}},
+		{SQL: "UPDATE `Singers` SET `name` = @p1 WHERE `id` = @p2", Params: map[string]interface{}{"p1": "c-name", "p2": "c"}},
+		{SQL: "DELETE FROM `Singers` WHERE `id` = @p1", Params: map[string]interface{}{"p1": "b"}},
+	}, stmts)
+
+	if _, err := sd.SQL("Singers"); err == nil {
+		t.Fatal("changesFor other than the labels must be an error")
+	}
+}
+
+func TestSQLDiff_ColumnOrder(t *testing.T) {
+	pks := []string{"id"}
+	rd := &RowsDiff{
+		Rows2Only: []*Row{{pks, map[string]ColumnValue{"id": "b", "name": "nb", "age": int64(2), "birthday": nil}}},
+		DiffRows: []*RowDiff{{PrimaryKey{"c"},
+			&Row{pks, map[string]ColumnValue{"id": "c", "name": "nc", "age": int64(3)}},
+			&Row{pks, map[string]ColumnValue{"id": "c", "name": "nc2", "age": int64(4)}},
+		}},
+		Columns: []string{"id", "name", "age", "birthday"},
+	}
+	sd, err := NewSQLDiff(rd, "Table1", "Table2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sqls, err := sd.SQL("Table1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{
+			"INSERT INTO `Table1` (`id`,`name`,`age`,`birthday`) VALUES ('b','nb',2,NULL)",
+			"UPDATE `Table1` SET `name` = 'nc2',`age` = 4 WHERE `id` = 'c'",
+		}, sqls)
+	}
+}
@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/spanner"
+)
+
+// JSONStatement is a serializable form of spanner.Statement with the params encoded as JSONValue
+type JSONStatement struct {
+	SQL    string                `json:"sql"`
+	Params map[string]*JSONValue `json:"params,omitempty"`
+}
+
+func NewJSONStatement(stmt spanner.Statement) *JSONStatement {
+	js := &JSONStatement{SQL: stmt.SQL}
+	if len(stmt.Params) > 0 {
+		js.Params = make(map[string]*JSONValue)
+		for name, v := range stmt.Params {
+			js.Params[name] = NewJSONValue(v)
+		}
+	}
+	return js
+}
+
+// Statement decodes the params and returns the statement to execute
+func (js *JSONStatement) Statement() (spanner.Statement, error) {
+	stmt := spanner.Statement{SQL: js.SQL, Params: make(map[string]interface{})}
+	for name, jv := range js.Params {
+		v, err := jv.Decode()
+		if err != nil {
+			return spanner.Statement{}, err
+		}
+		stmt.Params[name] = v
+	}
+	return stmt, nil
+}
+
+// WriteStatements writes the statements as JSON Lines of JSONStatement, which can be read by ReadStatements
+func WriteStatements(w io.Writer, stmts []spanner.Statement) error {
+	enc := json.NewEncoder(w)
+	for _, stmt := range stmts {
+		if err := enc.Encode(NewJSONStatement(stmt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ReadStatements(r io.Reader) ([]spanner.Statement, error) {
+	var stmts []spanner.Statement
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		js := &JSONStatement{}
+		if err := dec.Decode(js); err != nil {
+			return nil, err
+		}
+		stmt, err := js.Statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteStatements(t *testing.T) {
+	ts := time.Date(2020, 1, 29, 12, 0, 0, 0, time.UTC)
+	stmts := []spanner.Statement{
+		{SQL: "UPDATE `Singers` SET `UpdatedAt` = @p1, `Tags` = @p2 WHERE `SingerID` = @p3", Params: map[string]interface{}{
+			"p1": ts,
+			"p2": []string{"a", "b"},
+			"p3": int64(1),
+		}},
+		{SQL: "DELETE FROM `Singers` WHERE `SingerID` IS NULL", Params: map[string]interface{}{}},
+	}
+	var buf bytes.Buffer
+	if err := WriteStatements(&buf, stmts); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), `"p3":{"type":"INT64","value":"1"}`)
+
+	read, err := ReadStatements(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(read))
+	assert.Equal(t, stmts[0].SQL, read[0].SQL)
+	for name, v := range stmts[0].Params {
+		assert.True(t, EqualValues(v, read[0].Params[name]), name)
+	}
+	assert.Equal(t, 0, len(read[1].Params))
+}
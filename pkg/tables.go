@@ -0,0 +1,40 @@
+package pkg
+
+// Differences among the sets of tables of two databases
+type TablesDiff struct {
+	Tables1Only  []string
+	Tables2Only  []string
+	CommonTables []string
+}
+
+func (d *TablesDiff) HasDiff() bool {
+	return len(d.Tables1Only) > 0 || len(d.Tables2Only) > 0
+}
+
+// CompareTableNames matches tables by name.
+// CommonTables keeps the order of tables1.
+func CompareTableNames(tables1, tables2 []string) *TablesDiff {
+	set1 := make(map[string]struct{}, len(tables1))
+	for _, t := range tables1 {
+		set1[t] = struct{}{}
+	}
+	set2 := make(map[string]struct{}, len(tables2))
+	for _, t := range tables2 {
+		set2[t] = struct{}{}
+	}
+
+	df := &TablesDiff{}
+	for _, t := range tables1 {
+		if _, exists2 := set2[t]; exists2 {
+			df.CommonTables = append(df.CommonTables, t)
+		} else {
+			df.Tables1Only = append(df.Tables1Only, t)
+		}
+	}
+	for _, t := range tables2 {
+		if _, exists1 := set1[t]; !exists1 {
+			df.Tables2Only = append(df.Tables2Only, t)
+		}
+	}
+	return df
+}
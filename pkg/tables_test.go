@@ -0,0 +1,23 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareTableNames(t *testing.T) {
+	{
+		td := CompareTableNames([]string{"Singers", "Albums"}, []string{"Albums", "Singers"})
+		assert.Equal(t, false, td.HasDiff())
+		assert.Equal(t, []string{"Singers", "Albums"}, td.CommonTables)
+	}
+
+	{
+		td := CompareTableNames([]string{"Singers", "Albums", "Songs"}, []string{"Concerts", "Singers"})
+		assert.Equal(t, true, td.HasDiff())
+		assert.Equal(t, []string{"Albums", "Songs"}, td.Tables1Only)
+		assert.Equal(t, []string{"Concerts"}, td.Tables2Only)
+		assert.Equal(t, []string{"Singers"}, td.CommonTables)
+	}
+}
@@ -103,7 +103,7 @@ func (ud *UnifiedDiff) Write(rd *RowsDiff, changesFor string) error {
 
 func (ud *UnifiedDiff) validateChangesFor(changesFor string) error {
 	if changesFor != ud.rows1Label && changesFor != ud.rows2Label {
-		return fmt.Errorf("chnagesFor must be '%s' or '%s'", ud.rows1Label, ud.rows2Label)
+		return fmt.Errorf("changesFor must be '%s' or '%s'", ud.rows1Label, ud.rows2Label)
 	}
 	return nil
 }
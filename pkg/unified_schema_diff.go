@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fatih/color"
+)
+
+type UnifiedSchemaDiff struct {
+	w            io.Writer
+	schema1Label string
+	schema2Label string
+}
+
+func NewUnifiedSchemaDiff(w io.Writer, schema1Label, schema2Label string) (*UnifiedSchemaDiff, error) {
+	return &UnifiedSchemaDiff{
+		w:            w,
+		schema1Label: schema1Label,
+		schema2Label: schema2Label,
+	}, nil
+}
+
+func (ud *UnifiedSchemaDiff) printf(format string, a ...interface{}) {
+	fmt.Fprintf(ud.w, format, a...)
+}
+
+func (ud *UnifiedSchemaDiff) Write(sd *SchemaDiff, changesFor string) error {
+	if changesFor != ud.schema1Label && changesFor != ud.schema2Label {
+		return fmt.Errorf("changesFor must be '%s' or '%s'", ud.schema1Label, ud.schema2Label)
+	}
+
+	reversed := changesFor == ud.schema2Label
+	before, after := ud.schema1Label, ud.schema2Label
+	tablesAdded, tablesDeleted := sd.Tables2Only, sd.Tables1Only
+	if reversed {
+		before, after = after, before
+		tablesAdded, tablesDeleted = tablesDeleted, tablesAdded
+	}
+
+	deleted := color.New(colorDeleted).FprintfFunc()
+	added := color.New(colorAdded).FprintfFunc()
+	deleted(ud.w, "--- schema on %s\n", before)
+	added(ud.w, "+++ schema on %s\n", after)
+
+	if !sd.HasDiff() {
+		ud.printf("No schema diff found\n\n")
+		return nil
+	}
+
+	for _, t := range tablesAdded {
+		added(ud.w, "+ TABLE `%s`\n", t.Name)
+	}
+	for _, t := range tablesDeleted {
+		deleted(ud.w, "- TABLE `%s`\n", t.Name)
+	}
+	for _, td := range sd.DiffTables {
+		ud.writeTableDiff(td, reversed)
+	}
+	ud.printf("\n %d tables added, %d tables deleted, %d tables altered\n\n", len(tablesAdded), len(tablesDeleted), len(sd.DiffTables))
+	return nil
+}
+
+func (ud *UnifiedSchemaDiff) writeTableDiff(td *TableSchemaDiff, reversed bool) {
+	deleted := color.New(colorDeleted).FprintfFunc()
+	added := color.New(colorAdded).FprintfFunc()
+
+	t1, t2 := td.Table1, td.Table2
+	colsAdded, colsDeleted := td.Columns2Only, td.Columns1Only
+	idxesAdded, idxesDeleted := td.Indexes2Only, td.Indexes1Only
+	fksAdded, fksDeleted := td.ForeignKeys2Only, td.ForeignKeys1Only
+	if reversed {
+		t1, t2 = t2, t1
+		colsAdded, colsDeleted = colsDeleted, colsAdded
+		idxesAdded, idxesDeleted = idxesDeleted, idxesAdded
+		fksAdded, fksDeleted = fksDeleted, fksAdded
+	}
+
+	ud.printf(" ************************* TABLE `%s` *************************\n", td.Name)
+	for _, cd := range td.DiffColumns {
+		c1, c2 := cd.Column1, cd.Column2
+		if reversed {
+			c1, c2 = c2, c1
+		}
+		deleted(ud.w, "-   %s\n", columnDefinition(c1))
+		added(ud.w, "+   %s\n", columnDefinition(c2))
+	}
+	for _, c := range colsAdded {
+		added(ud.w, "+   %s\n", columnDefinition(c))
+	}
+	for _, c := range colsDeleted {
+		deleted(ud.w, "-   %s\n", columnDefinition(c))
+	}
+	if td.PrimaryKeyDiffers || td.InterleaveDiffers {
+		deleted(ud.w, "- %s\n", primaryKeyDefinition(t1))
+		added(ud.w, "+ %s\n", primaryKeyDefinition(t2))
+	}
+	for _, id := range td.DiffIndexes {
+		idx1, idx2 := id.Index1, id.Index2
+		if reversed {
+			idx1, idx2 = idx2, idx1
+		}
+		deleted(ud.w, "- %s\n", indexDefinition(idx1))
+		added(ud.w, "+ %s\n", indexDefinition(idx2))
+	}
+	for _, idx := range idxesAdded {
+		added(ud.w, "+ %s\n", indexDefinition(idx))
+	}
+	for _, idx := range idxesDeleted {
+		deleted(ud.w, "- %s\n", indexDefinition(idx))
+	}
+	for _, fd := range td.DiffForeignKeys {
+		fk1, fk2 := fd.ForeignKey1, fd.ForeignKey2
+		if reversed {
+			fk1, fk2 = fk2, fk1
+		}
+		deleted(ud.w, "- %s\n", foreignKeyDefinition(fk1))
+		added(ud.w, "+ %s\n", foreignKeyDefinition(fk2))
+	}
+	for _, fk := range fksAdded {
+		added(ud.w, "+ %s\n", foreignKeyDefinition(fk))
+	}
+	for _, fk := range fksDeleted {
+		deleted(ud.w, "- %s\n", foreignKeyDefinition(fk))
+	}
+}
@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+)
+
+// ValueType is the Spanner type of a column value
+type ValueType string
+
+const (
+	TypeUnknown   ValueType = ""
+	TypeBool      ValueType = "BOOL"
+	TypeInt64     ValueType = "INT64"
+	TypeFloat64   ValueType = "FLOAT64"
+	TypeNumeric   ValueType = "NUMERIC"
+	TypeString    ValueType = "STRING"
+	TypeBytes     ValueType = "BYTES"
+	TypeDate      ValueType = "DATE"
+	TypeTimestamp ValueType = "TIMESTAMP"
+	TypeArray     ValueType = "ARRAY"
+	TypeStruct    ValueType = "STRUCT"
+)
+
+// TypeOf returns the Spanner type of the value.
+// TypeUnknown is returned for untyped NULL (nil).
+func TypeOf(v ColumnValue) ValueType {
+	typ, _ := normalizeValue(v)
+	return typ
+}
+
+// normalizeValue converts a value decoded by DataSource into the canonical Go type of its Spanner type:
+// bool, int64, float64, *big.Rat, string, []byte, civil.Date, time.Time, []interface{} (ARRAY) or the struct itself (STRUCT).
+// NULL is returned as nil with its type if known.
+func normalizeValue(v ColumnValue) (ValueType, interface{}) {
+	switch tv := v.(type) {
+	case nil:
+		return TypeUnknown, nil
+	case bool:
+		return TypeBool, tv
+	case spanner.NullBool:
+		if !tv.Valid {
+			return TypeBool, nil
+		}
+		return TypeBool, tv.Bool
+	case int:
+		return TypeInt64, int64(tv)
+	case int8:
+		return TypeInt64, int64(tv)
+	case int16:
+		return TypeInt64, int64(tv)
+	case int32:
+		return TypeInt64, int64(tv)
+	case int64:
+		return TypeInt64, tv
+	case uint8:
+		return TypeInt64, int64(tv)
+	case uint16:
+		return TypeInt64, int64(tv)
+	case uint32:
+		return TypeInt64, int64(tv)
+	case spanner.NullInt64:
+		if !tv.Valid {
+			return TypeInt64, nil
+		}
+		return TypeInt64, tv.Int64
+	case float32:
+		return TypeFloat64, float64(tv)
+	case float64:
+		return TypeFloat64, tv
+	case spanner.NullFloat64:
+		if !tv.Valid {
+			return TypeFloat64, nil
+		}
+		return TypeFloat64, tv.Float64
+	case big.Rat:
+		return TypeNumeric, &tv
+	case *big.Rat:
+		if tv == nil {
+			return TypeNumeric, nil
+		}
+		return TypeNumeric, tv
+	case string:
+		return TypeString, tv
+	case spanner.NullString:
+		if !tv.Valid {
+			return TypeString, nil
+		}
+		return TypeString, tv.StringVal
+	case []byte:
+		if tv == nil {
+			return TypeBytes, nil
+		}
+		return TypeBytes, tv
+	case civil.Date:
+		return TypeDate, tv
+	case spanner.NullDate:
+		if !tv.Valid {
+			return TypeDate, nil
+		}
+		return TypeDate, tv.Date
+	case time.Time:
+		return TypeTimestamp, tv
+	case spanner.NullTime:
+		if !tv.Valid {
+			return TypeTimestamp, nil
+		}
+		return TypeTimestamp, tv.Time
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			typ, _ := normalizeValue(reflect.Zero(rv.Type().Elem()).Interface())
+			return typ, nil
+		}
+		return normalizeValue(rv.Elem().Interface())
+	case reflect.Slice:
+		if rv.IsNil() {
+			return TypeArray, nil
+		}
+		elems := make([]interface{}, rv.Len())
+		for i := range elems {
+			elems[i] = rv.Index(i).Interface()
+		}
+		return TypeArray, elems
+	case reflect.Struct:
+		return TypeStruct, v
+	}
+	return TypeUnknown, v
+}
+
+// FloatTolerance is the allowed difference between FLOAT64 values.
+// Two values are equal if |v1-v2| <= Absolute or |v1-v2| <= Relative * max(|v1|, |v2|).
+type FloatTolerance struct {
+	Absolute float64
+	Relative float64
+}
+
+type NaNPolicy int
+
+const (
+	// NaN equals NaN
+	NaNEqual NaNPolicy = iota
+	// NaN does not equal any value including NaN, as defined by IEEE 754
+	NaNNotEqual
+)
+
+type SignedZeroPolicy int
+
+const (
+	// +0 equals -0
+	SignedZeroEqual SignedZeroPolicy = iota
+	// +0 does not equal -0
+	SignedZeroDistinct
+)
+
+// ValueComparator compares column values according to their Spanner types.
+// The zero value compares values exactly.
+type ValueComparator struct {
+	FloatTolerance FloatTolerance
+	NaN            NaNPolicy
+	SignedZero     SignedZeroPolicy
+	// TIMESTAMP values are equal if the difference is within TimestampTolerance
+	TimestampTolerance time.Duration
+	// TIMESTAMP values are truncated to a multiple of TimestampTruncation (e.g. time.Second) before comparison
+	TimestampTruncation time.Duration
+}
+
+// EqualValues reports whether two column values are equal according to their Spanner types.
+// NULL equals only NULL, and values of different types (e.g. STRING and BYTES) are never equal.
+// NaN equals NaN so that the same FLOAT64 values are not reported as differences.
+func EqualValues(v1, v2 ColumnValue) bool {
+	return (&ValueComparator{}).Equal(v1, v2)
+}
+
+func (vc *ValueComparator) Equal(v1, v2 ColumnValue) bool {
+	typ1, nv1 := normalizeValue(v1)
+	typ2, nv2 := normalizeValue(v2)
+	if nv1 == nil || nv2 == nil {
+		return nv1 == nil && nv2 == nil
+	}
+	if typ1 != typ2 {
+		return false
+	}
+
+	switch typ1 {
+	case TypeFloat64:
+		return vc.equalFloats(nv1.(float64), nv2.(float64))
+	case TypeNumeric:
+		return nv1.(*big.Rat).Cmp(nv2.(*big.Rat)) == 0
+	case TypeBytes:
+		return bytes.Equal(nv1.([]byte), nv2.([]byte))
+	case TypeTimestamp:
+		return vc.equalTimestamps(nv1.(time.Time), nv2.(time.Time))
+	case TypeArray:
+		elems1, elems2 := nv1.([]interface{}), nv2.([]interface{})
+		if len(elems1) != len(elems2) {
+			return false
+		}
+		for i := range elems1 {
+			if !vc.Equal(elems1[i], elems2[i]) {
+				return false
+			}
+		}
+		return true
+	case TypeStruct, TypeUnknown:
+		return reflect.DeepEqual(nv1, nv2)
+	}
+	return nv1 == nv2
+}
+
+func (vc *ValueComparator) equalFloats(f1, f2 float64) bool {
+	nan1, nan2 := math.IsNaN(f1), math.IsNaN(f2)
+	if nan1 || nan2 {
+		return nan1 && nan2 && vc.NaN == NaNEqual
+	}
+	if f1 == 0 && f2 == 0 {
+		return vc.SignedZero == SignedZeroEqual || math.Signbit(f1) == math.Signbit(f2)
+	}
+	if f1 == f2 {
+		return true
+	}
+	if math.IsInf(f1, 0) || math.IsInf(f2, 0) {
+		return false
+	}
+	d := math.Abs(f1 - f2)
+	return d <= vc.FloatTolerance.Absolute || d <= vc.FloatTolerance.Relative*math.Max(math.Abs(f1), math.Abs(f2))
+}
+
+func (vc *ValueComparator) equalTimestamps(t1, t2 time.Time) bool {
+	if vc.TimestampTruncation > 0 {
+		t1, t2 = t1.Truncate(vc.TimestampTruncation), t2.Truncate(vc.TimestampTruncation)
+	}
+	d := t1.Sub(t2)
+	if d < 0 {
+		d = -d
+	}
+	return d <= vc.TimestampTolerance
+}
@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypeOf(t *testing.T) {
+	assert.Equal(t, TypeUnknown, TypeOf(nil))
+	assert.Equal(t, TypeBool, TypeOf(true))
+	assert.Equal(t, TypeInt64, TypeOf(int64(1)))
+	assert.Equal(t, TypeInt64, TypeOf(spanner.NullInt64{}))
+	assert.Equal(t, TypeFloat64, TypeOf(1.5))
+	assert.Equal(t, TypeNumeric, TypeOf(big.NewRat(1, 3)))
+	assert.Equal(t, TypeString, TypeOf("a"))
+	assert.Equal(t, TypeBytes, TypeOf([]byte("a")))
+	assert.Equal(t, TypeDate, TypeOf(civil.Date{Year: 2020, Month: 1, Day: 1}))
+	assert.Equal(t, TypeTimestamp, TypeOf(time.Now()))
+	assert.Equal(t, TypeArray, TypeOf([]int64{1, 2}))
+	assert.Equal(t, TypeArray, TypeOf([]string(nil)))
+}
+
+func TestEqualValues(t *testing.T) {
+	ts := time.Date(2020, 1, 29, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		v1    ColumnValue
+		v2    ColumnValue
+		equal bool
+	}{
+		{nil, nil, true},
+		{spanner.NullString{}, spanner.NullInt64{}, true},
+		{spanner.NullString{}, "<nil>", false},
+		{spanner.NullString{}, "", false},
+		{nil, "<nil>", false},
+		{spanner.NullString{StringVal: "a", Valid: true}, "a", true},
+		{int64(1), int64(1), true},
+		{int64(1), int64(2), false},
+		{int64(1), 1, true},
+		{int64(1), 1.0, false},
+		{int64(1), "1", false},
+		{1.5, 1.5, true},
+		{math.NaN(), math.NaN(), true},
+		{0.0, math.Copysign(0, -1), true},
+		{big.NewRat(1, 2), big.NewRat(2, 4), true},
+		{big.NewRat(1, 2), big.NewRat(1, 3), false},
+		{"a", []byte("a"), false},
+		{[]byte("a"), []byte("a"), true},
+		{[]byte("a"), []byte(nil), false},
+		{[]byte{}, []byte(nil), false},
+		{true, spanner.NullBool{Bool: true, Valid: true}, true},
+		{civil.Date{Year: 2020, Month: 1, Day: 1}, civil.Date{Year: 2020, Month: 1, Day: 1}, true},
+		{ts, ts.In(time.FixedZone("JST", 9*60*60)), true},
+		{ts, ts.Add(time.Nanosecond), false},
+		{[]int64{1, 2}, []int64{1, 2}, true},
+		{[]int64{1, 2}, []int64{2, 1}, false},
+		{[]int64{}, []int64(nil), false},
+		{[]int64{1}, []spanner.NullInt64{{Int64: 1, Valid: true}}, true},
+		{[]spanner.NullInt64{{}}, []spanner.NullInt64{{}}, true},
+		{[]string{"a"}, [][]byte{[]byte("a")}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.equal, EqualValues(c.v1, c.v2), "%#v and %#v", c.v1, c.v2)
+		assert.Equal(t, c.equal, EqualValues(c.v2, c.v1), "%#v and %#v", c.v2, c.v1)
+	}
+}
+
+func TestValueComparator_Float(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+	// computed at run time, 0.30000000000000004
+	sum := 0.1
+	sum += 0.2
+	cases := []struct {
+		vc    *ValueComparator
+		v1    ColumnValue
+		v2    ColumnValue
+		equal bool
+	}{
+		{&ValueComparator{}, sum, 0.3, false},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Absolute: 1e-9}}, sum, 0.3, true},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Absolute: 1e-9}}, 1.0, 1.1, false},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Relative: 1e-9}}, 1e10, 1e10 + 1, true},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Relative: 1e-9}}, 1e-10, 2e-10, false},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Absolute: 1}}, math.Inf(1), math.Inf(1), true},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Absolute: 1}}, math.Inf(1), math.MaxFloat64, false},
+		{&ValueComparator{}, math.NaN(), math.NaN(), true},
+		{&ValueComparator{NaN: NaNNotEqual}, math.NaN(), math.NaN(), false},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Absolute: 1}}, math.NaN(), 0.0, false},
+		{&ValueComparator{}, 0.0, negZero, true},
+		{&ValueComparator{SignedZero: SignedZeroDistinct}, 0.0, negZero, false},
+		{&ValueComparator{SignedZero: SignedZeroDistinct}, negZero, negZero, true},
+		{&ValueComparator{FloatTolerance: FloatTolerance{Absolute: 1e-9}}, []float64{sum}, []float64{0.3}, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.equal, c.vc.Equal(c.v1, c.v2), "%#v: %v and %v", c.vc, c.v1, c.v2)
+	}
+}
+
+func TestValueComparator_Timestamp(t *testing.T) {
+	ts := time.Date(2020, 1, 29, 12, 34, 56, 789000000, time.UTC)
+	cases := []struct {
+		vc    *ValueComparator
+		v1    ColumnValue
+		v2    ColumnValue
+		equal bool
+	}{
+		{&ValueComparator{}, ts, ts.Add(time.Millisecond), false},
+		{&ValueComparator{TimestampTolerance: 5 * time.Second}, ts, ts.Add(5 * time.Second), true},
+		{&ValueComparator{TimestampTolerance: 5 * time.Second}, ts.Add(5 * time.Second), ts, true},
+		{&ValueComparator{TimestampTolerance: 5 * time.Second}, ts, ts.Add(6 * time.Second), false},
+		{&ValueComparator{TimestampTruncation: time.Second}, ts, ts.Add(200 * time.Millisecond), true},
+		{&ValueComparator{TimestampTruncation: time.Second}, ts, ts.Add(300 * time.Millisecond), false},
+		{&ValueComparator{TimestampTruncation: 24 * time.Hour}, ts, time.Date(2020, 1, 29, 0, 0, 0, 0, time.UTC), true},
+		{&ValueComparator{TimestampTruncation: 24 * time.Hour}, ts, time.Date(2020, 1, 30, 0, 0, 0, 0, time.UTC), false},
+		{&ValueComparator{TimestampTolerance: time.Hour}, spanner.NullTime{}, ts, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.equal, c.vc.Equal(c.v1, c.v2), "%#v: %v and %v", c.vc, c.v1, c.v2)
+	}
+}